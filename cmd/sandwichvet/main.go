@@ -0,0 +1,11 @@
+// Command sandwichvet checks sandwich annotations, run it by go vet -vettool=$(which sandwichvet) ./...
+package main
+
+import (
+	"github.com/go-park/sandwich/pkg/analyzer"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
@@ -12,17 +12,17 @@ import (
 )
 
 type BarProxy struct {
-	parent Bar
+	parent *Bar
 }
 
-//@Component
+// @Component
 func NewBarProxy() IBar {
 	pa := &Bar{
 		foo:    NewFooProxy(),
 		libFoo: lib.NewFoo(),
 	}
 
-	return pa
+	return &BarProxy{parent: pa}
 }
 
 func (p *BarProxy) Foo(ctx context.Context, i any, tx *gorm.DB) (r0 any, r1 error) {
@@ -13,25 +13,27 @@ import (
 )
 
 type FooProxy struct {
-	parent Foo
+	parent *Foo
 }
 
 var (
-	_IFooInst IFoo
-	_IFooOnce sync.Once
+	_FooProxyInst IFoo
+	_FooProxyOnce sync.Once
 )
 
-//@Component
+// @Component
 func NewFooProxy() IFoo {
-	_IFooOnce.Do(func() {
-		_IFooInst = &Foo{
-			foo: lib.NewFoo(),
-			str: "123",
-			boo: true,
-			num: 123,
+	_FooProxyOnce.Do(func() {
+		_FooProxyInst = &FooProxy{
+			parent: &Foo{
+				foo: lib.NewFoo(),
+				str: "123",
+				boo: true,
+				num: 123,
+			},
 		}
 	})
-	return _IFooInst
+	return _FooProxyInst
 }
 
 func (p *FooProxy) Foo(ctx context.Context, i any, tx *gorm.DB) (r0 any, r1 error) {
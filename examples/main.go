@@ -12,7 +12,10 @@ import (
 
 //go:generate go run  ./... -tags=sandwich .
 func main() {
-	astutils.RegisterFieldInterceptors(ValueInterceotor)
+	astutils.RegisterExtension(astutils.Extension{
+		Name:              "value",
+		FieldInterceptors: []astutils.FieldInterceptor{ValueInterceotor},
+	})
 	gen.Do()
 }
 
@@ -1,11 +1,14 @@
 module github.com/go-park/sandwich
 
-go 1.18
+go 1.22.0
 
 require (
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirupsen/logrus v1.9.0
 	github.com/stretchr/testify v1.7.0
-	golang.org/x/tools v0.3.0
+	golang.org/x/mod v0.21.0
+	golang.org/x/tools v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/gorm v1.24.1
 )
 
@@ -13,8 +16,6 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/mod v0.7.0 // indirect
-	golang.org/x/sys v0.2.0 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 )
@@ -0,0 +1,342 @@
+// Package analyzer reports misuse of sandwich annotations. Analyzer can be run
+// by go vet -vettool, see cmd/sandwichvet, or added to a multichecker.
+//
+// Aspects and components are looked up in every go file of the module,
+// regardless of build tags, since aspects are usually built by the generator only.
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/go-park/sandwich/pkg/tools/collections"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/analysis"
+)
+
+const doc = `check sandwich annotations
+
+Reports @Pointcut on functions without receiver, @Proxy on non-struct or
+unexported types, pointcuts naming aspects which do not exist, @Inject fields
+without matching @Component, @Aspect structs without advice, unknown
+annotation keys and ParamTo(i)/ResultTo(i) out of range of the advised method.`
+
+var Analyzer = &analysis.Analyzer{
+	Name: "sandwich",
+	Doc:  doc,
+	Run:  run,
+}
+
+var annotations string
+
+func init() {
+	Analyzer.Flags.StringVar(&annotations, "annotations", string(astutils.SyntaxBoth),
+		"accepted annotation syntax, comment, directive or both")
+}
+
+type checker struct {
+	pass   *analysis.Pass
+	syntax astutils.AnnotationSyntax
+	idx    *index
+	// pointcuts declared on @Proxy structs, by struct name
+	structCuts map[string][]string
+	// receivers of advice methods
+	advised map[string]struct{}
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	syntax := astutils.AnnotationSyntax(annotations)
+	if err := syntax.Validate(); err != nil {
+		return nil, err
+	}
+	if len(pass.Files) == 0 {
+		return nil, nil
+	}
+	dir := filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+	root, rootPath := moduleRoot(dir)
+	if len(root) == 0 {
+		root, rootPath = dir, pass.Pkg.Path()
+	}
+	c := &checker{
+		pass:       pass,
+		syntax:     syntax,
+		idx:        loadIndex(root, rootPath, syntax),
+		structCuts: map[string][]string{},
+		advised:    map[string]struct{}{},
+	}
+	var files []*ast.File
+	for _, f := range pass.Files {
+		if ast.IsGenerated(f) {
+			continue
+		}
+		files = append(files, f)
+		c.collect(f)
+	}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				c.checkKeys(decl.Doc)
+				if decl.Tok == token.TYPE {
+					c.checkType(decl)
+				}
+			case *ast.FuncDecl:
+				c.checkKeys(decl.Doc)
+				c.checkFunc(decl)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// collect records struct level pointcuts and advice receivers of the package.
+func (c *checker) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE || len(decl.Specs) == 0 {
+				continue
+			}
+			spec, ok := decl.Specs[0].(*ast.TypeSpec)
+			annos := c.syntax.ParseAnnotation(decl.Doc)
+			if ok && collections.Contains(annos, astutils.CommentProxy) && collections.Contains(annos, astutils.CommentPointcut) {
+				c.structCuts[spec.Name.Name] = pointcutNames(c.syntax, decl.Doc)
+			}
+		case *ast.FuncDecl:
+			annos := c.syntax.ParseAnnotation(decl.Doc)
+			if collections.ContainsAny(annos, astutils.AdviceAnnotationList()...) {
+				c.advised[recvName(decl)] = struct{}{}
+			}
+		}
+	}
+}
+
+// checkKeys reports keys which are not accepted by system annotations.
+func (c *checker) checkKeys(doc *ast.CommentGroup) {
+	for _, anno := range collections.Distinct(c.syntax.ParseAnnotation(doc)) {
+		if !astutils.IsSystemAnnotation(anno) {
+			continue
+		}
+		params := c.syntax.GetCommentParam(doc, anno)
+		keys := make([]string, 0, len(params))
+		for k := range params {
+			if !astutils.IsAnnotationKey(anno, k) {
+				keys = append(keys, string(k))
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			c.pass.Reportf(doc.Pos(), "unknown key %q of %s", k, anno)
+		}
+	}
+}
+
+func (c *checker) checkType(decl *ast.GenDecl) {
+	if len(decl.Specs) == 0 {
+		return
+	}
+	spec, ok := decl.Specs[0].(*ast.TypeSpec)
+	if !ok {
+		return
+	}
+	annos := c.syntax.ParseAnnotation(decl.Doc)
+	if collections.Contains(annos, astutils.CommentProxy) {
+		c.checkProxy(decl, spec)
+	}
+	if collections.Contains(annos, astutils.CommentAspect) {
+		if _, ok := c.advised[spec.Name.Name]; !ok {
+			c.pass.Reportf(spec.Name.Pos(), "@Aspect %s has none of @Before, @After or @Around", spec.Name.Name)
+		}
+	}
+}
+
+func (c *checker) checkProxy(decl *ast.GenDecl, spec *ast.TypeSpec) {
+	structT, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		c.pass.Reportf(spec.Name.Pos(), "@Proxy on non-struct type %s", spec.Name.Name)
+		return
+	}
+	if !ast.IsExported(spec.Name.Name) {
+		c.pass.Reportf(spec.Name.Pos(), "@Proxy on unexported type %s", spec.Name.Name)
+	}
+	for _, name := range c.structCuts[spec.Name.Name] {
+		c.resolve(decl.Doc.Pos(), name)
+	}
+	if structT.Fields == nil {
+		return
+	}
+	for _, fi := range structT.Fields.List {
+		c.checkKeys(fi.Doc)
+		if collections.Contains(c.syntax.ParseAnnotation(fi.Doc), astutils.CommentInject) {
+			c.checkInject(fi)
+		}
+	}
+}
+
+// checkInject reports an injected field whose type is provided by no component of the module,
+// types of other modules are not checked.
+func (c *checker) checkInject(fi *ast.Field) {
+	typ := c.pass.TypesInfo.TypeOf(fi.Type)
+	if typ == nil {
+		return
+	}
+	star := ""
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+		star = "*"
+	}
+	named, ok := types.Unalias(typ).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return
+	}
+	obj := named.Obj()
+	if !c.idx.inModule(obj.Pkg().Path()) {
+		return
+	}
+	key := obj.Pkg().Path() + "." + star + obj.Name()
+	if _, ok := c.idx.components[key]; ok {
+		return
+	}
+	qualifier := func(p *types.Package) string { return p.Name() }
+	for _, name := range fi.Names {
+		c.pass.Reportf(name.Pos(), "no @Component provides %s%s for injected field %s", star, types.TypeString(named, qualifier), name.Name)
+	}
+}
+
+func (c *checker) checkFunc(decl *ast.FuncDecl) {
+	annos := collections.Distinct(c.syntax.ParseAnnotation(decl.Doc))
+	if len(annos) == 0 || collections.Contains(annos, astutils.CommentComponent) {
+		return
+	}
+	isPointcut := collections.Contains(annos, astutils.CommentPointcut)
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		if isPointcut {
+			c.pass.Reportf(decl.Name.Pos(), "@Pointcut on function %s without receiver", decl.Name.Name)
+		}
+		return
+	}
+	var names []string
+	if isPointcut {
+		names = pointcutNames(c.syntax, decl.Doc)
+	}
+	// custom aspect annotations
+	for _, anno := range annos {
+		if !astutils.IsSystemAnnotation(anno) {
+			names = append(names, anno.String())
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	var aspects []*aspectInfo
+	for _, name := range names {
+		if a, ok := c.resolve(decl.Doc.Pos(), name); ok {
+			aspects = append(aspects, a)
+		}
+	}
+	for _, name := range c.structCuts[recvName(decl)] {
+		if a, ok := c.idx.resolve(name); ok {
+			aspects = append(aspects, a)
+		}
+	}
+	for _, a := range aspects {
+		for _, advice := range a.advices {
+			c.checkPlaceholders(decl, a, advice)
+		}
+	}
+}
+
+// resolve reports a pointcut name which does not match any aspect.
+func (c *checker) resolve(pos token.Pos, name string) (*aspectInfo, bool) {
+	a, ok := c.idx.resolve(name)
+	if ok {
+		return a, true
+	}
+	if strings.HasPrefix(name, "@") {
+		c.pass.Reportf(pos, "annotation %s does not match any custom aspect", name)
+	} else {
+		c.pass.Reportf(pos, "unknown aspect %q", name)
+	}
+	return nil, false
+}
+
+// checkPlaceholders reports ParamTo(i) and ResultTo(i) of advice out of range of method.
+func (c *checker) checkPlaceholders(method *ast.FuncDecl, a *aspectInfo, advice *ast.FuncDecl) {
+	fn, ok := c.pass.TypesInfo.Defs[method.Name].(*types.Func)
+	if !ok || advice.Body == nil {
+		return
+	}
+	params := advice.Type.Params
+	if params == nil || len(params.List) == 0 || len(params.List[0].Names) == 0 {
+		return
+	}
+	jpName := params.List[0].Names[0].Name
+	sig := fn.Type().(*types.Signature)
+	ast.Inspect(advice.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != jpName {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return true
+		}
+		i, err := strconv.Atoi(lit.Value)
+		if err != nil {
+			return true
+		}
+		switch sel.Sel.Name {
+		case "ParamTo":
+			if i < 1 || i > sig.Params().Len() {
+				c.pass.Reportf(method.Name.Pos(), "%s.%s uses ParamTo(%d), %s has %d params",
+					a.name, advice.Name.Name, i, method.Name.Name, sig.Params().Len())
+			}
+		case "ResultTo":
+			if i < 1 || i > sig.Results().Len() {
+				c.pass.Reportf(method.Name.Pos(), "%s.%s uses ResultTo(%d), %s has %d results",
+					a.name, advice.Name.Name, i, method.Name.Name, sig.Results().Len())
+			}
+		}
+		return true
+	})
+}
+
+func pointcutNames(syntax astutils.AnnotationSyntax, doc *ast.CommentGroup) []string {
+	var names []string
+	params := syntax.GetCommentParam(doc, astutils.CommentPointcut)
+	for _, v := range strings.Split(params[astutils.CommentKeyDefault], ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			names = append(names, v)
+		}
+	}
+	return names
+}
+
+// moduleRoot returns the directory and path of the module containing dir.
+func moduleRoot(dir string) (string, string) {
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			return dir, modfile.ModulePath(data)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,249 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/go-park/sandwich/pkg/tools/collections"
+)
+
+type (
+	// index holds the aspects and components declared anywhere under a root directory.
+	// Build tags are ignored, aspects usually live in files only built by the generator.
+	index struct {
+		rootPath   string // import path of the root directory
+		syntax     astutils.AnnotationSyntax
+		aspects    map[string]*aspectInfo
+		alias      map[string]string
+		customs    map[astutils.Annotation]string
+		components map[string]struct{}
+	}
+	aspectInfo struct {
+		name    string
+		advices []*ast.FuncDecl
+	}
+)
+
+var (
+	indexes   sync.Map // root directory and annotation syntax -> *indexEntry
+	regexVerN = regexp.MustCompile(`^v[0-9]+$`)
+)
+
+type indexEntry struct {
+	once sync.Once
+	idx  *index
+}
+
+// loadIndex returns the index of root with annotations written in syntax, built once per process.
+func loadIndex(root, rootPath string, syntax astutils.AnnotationSyntax) *index {
+	v, _ := indexes.LoadOrStore(root+"\x00"+string(syntax), &indexEntry{})
+	e := v.(*indexEntry)
+	e.once.Do(func() {
+		e.idx = buildIndex(root, rootPath, syntax)
+	})
+	return e.idx
+}
+
+func buildIndex(root, rootPath string, syntax astutils.AnnotationSyntax) *index {
+	idx := &index{
+		rootPath:   rootPath,
+		syntax:     syntax,
+		aspects:    map[string]*aspectInfo{},
+		alias:      map[string]string{},
+		customs:    map[astutils.Annotation]string{},
+		components: map[string]struct{}{},
+	}
+	fset := token.NewFileSet()
+	_ = filepath.WalkDir(root, func(name string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			base := d.Name()
+			if name != root && (base == "vendor" || base == "testdata" ||
+				strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return filepath.SkipDir
+			}
+			// nested module
+			if _, err := os.Stat(filepath.Join(name, "go.mod")); err == nil && name != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(name))
+		if err != nil {
+			return nil
+		}
+		idx.addFile(f, path.Join(rootPath, filepath.ToSlash(rel)))
+		return nil
+	})
+	return idx
+}
+
+func (idx *index) addFile(f *ast.File, pkgPath string) {
+	pkgName := f.Name.Name
+	imports := map[string]string{}
+	for _, imp := range f.Imports {
+		p := strings.Trim(imp.Path.Value, `"`)
+		imports[importName(imp, p)] = p
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE || len(decl.Specs) == 0 {
+				continue
+			}
+			spec, ok := decl.Specs[0].(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			annos := idx.syntax.ParseAnnotation(decl.Doc)
+			if collections.Contains(annos, astutils.CommentAspect) {
+				fullName := pkgName + "." + spec.Name.Name
+				params := idx.syntax.GetCommentParam(decl.Doc, astutils.CommentAspect)
+				if alias := params[astutils.CommentKeyDefault]; len(alias) > 0 {
+					idx.alias[alias] = fullName
+				}
+				if anno, ok := astutils.ValidCustomAnnotation(params[astutils.CommentKeyCustom]); ok {
+					idx.customs[anno] = fullName
+				}
+				idx.aspect(fullName)
+			}
+			if collections.Contains(annos, astutils.CommentProxy) {
+				params := idx.syntax.GetCommentParam(decl.Doc, astutils.CommentProxy)
+				abstract := params[astutils.CommentKeyAbstract]
+				if v := params[astutils.CommentKeyDefault]; len(v) > 0 {
+					abstract = v
+				}
+				if len(abstract) > 0 {
+					idx.components[pkgPath+"."+astutils.TrimTypeArgs(abstract)] = struct{}{}
+				}
+			}
+		case *ast.FuncDecl:
+			annos := idx.syntax.ParseAnnotation(decl.Doc)
+			if collections.Contains(annos, astutils.CommentComponent) {
+				if key, ok := componentKey(decl, pkgPath, imports); ok {
+					idx.components[key] = struct{}{}
+				}
+				continue
+			}
+			if !collections.ContainsAny(annos, astutils.AdviceAnnotationList()...) {
+				continue
+			}
+			if recv := recvName(decl); len(recv) > 0 {
+				a := idx.aspect(pkgName + "." + recv)
+				a.advices = append(a.advices, decl)
+			}
+		}
+	}
+}
+
+func (idx *index) aspect(fullName string) *aspectInfo {
+	a, ok := idx.aspects[fullName]
+	if !ok {
+		a = &aspectInfo{name: fullName}
+		idx.aspects[fullName] = a
+	}
+	return a
+}
+
+// resolve finds the aspect of a pointcut name, which is an alias,
+// a custom annotation or the full name of the aspect.
+func (idx *index) resolve(name string) (*aspectInfo, bool) {
+	if alias, ok := idx.alias[name]; ok {
+		name = alias
+	} else if full, ok := idx.customs[astutils.Annotation(name)]; ok {
+		name = full
+	}
+	a, ok := idx.aspects[name]
+	return a, ok
+}
+
+// inModule reports whether the package path is indexed.
+func (idx *index) inModule(pkgPath string) bool {
+	return pkgPath == idx.rootPath || strings.HasPrefix(pkgPath, idx.rootPath+"/")
+}
+
+// componentKey returns the component name of a factory, the same way the generator names it.
+func componentKey(decl *ast.FuncDecl, pkgPath string, imports map[string]string) (string, bool) {
+	results := decl.Type.Results
+	if results == nil || len(results.List) != 1 {
+		return "", false
+	}
+	expr := results.List[0].Type
+	star := ""
+	if s, ok := expr.(*ast.StarExpr); ok {
+		expr = s.X
+		star = "*"
+	}
+	// instantiations of a generic type share its key, as injected fields are checked by their origin
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return pkgPath + "." + star + t.Name, true
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return "", false
+		}
+		p, ok := imports[x.Name]
+		if !ok {
+			return "", false
+		}
+		return p + "." + star + t.Sel.Name, true
+	}
+	return "", false
+}
+
+// importName guesses the package name of an import without loading it.
+func importName(imp *ast.ImportSpec, p string) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+	items := strings.Split(p, "/")
+	name := items[len(items)-1]
+	if regexVerN.MatchString(name) && len(items) > 1 {
+		name = items[len(items)-2]
+	}
+	return strings.TrimPrefix(name, "go-")
+}
+
+func recvName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr = t.X
+	case *ast.IndexListExpr:
+		expr = t.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
@@ -0,0 +1,23 @@
+//go:build sandwich
+
+package aspects
+
+import "example.com/fixture/lib"
+
+//@Aspect("log")
+type Log struct{}
+
+//@Before
+func (a *Log) Before(jp lib.Joinpoint) {
+	println(jp.ParamTo(2).(string))
+}
+
+//@Aspect("trans", custom="Transactional")
+type Trans struct{}
+
+//@Around
+func (a *Trans) Around(jp lib.Joinpoint) []any {
+	result := jp.Proceed()
+	println(jp.ResultTo(1).(error))
+	return result
+}
@@ -0,0 +1,4 @@
+package aspects
+
+//@Aspect("empty")
+type Empty struct{} // want `@Aspect Empty has none of @Before, @After or @Around`
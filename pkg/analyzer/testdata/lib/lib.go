@@ -0,0 +1,24 @@
+package lib
+
+type Joinpoint interface {
+	ParamTo(int) any
+	ResultTo(int) any
+	Proceed() []any
+}
+
+type Store interface {
+	Get(key string) string
+}
+
+type Cache interface {
+	Put(key string)
+}
+
+type store struct{}
+
+func (store) Get(key string) string { return key }
+
+//@Component
+func NewStore() Store {
+	return store{}
+}
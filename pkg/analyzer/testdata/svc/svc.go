@@ -0,0 +1,45 @@
+package svc
+
+import "example.com/fixture/lib"
+
+// want `unknown key "cache" of @Proxy`
+//@Proxy("IService", suffix="Impl", cache=true)
+type Service struct {
+	//@Inject
+	store lib.Store
+	//@Inject
+	cache lib.Cache // want `no @Component provides lib.Cache for injected field cache`
+}
+
+type IService interface {
+	Get(key, value string) (string, error)
+	Put(key string)
+}
+
+//@Pointcut("log")
+func (s *Service) Get(key, value string) (string, error) {
+	return s.store.Get(key), nil
+}
+
+// want `unknown aspect "missing"`
+//@Pointcut("log", "missing")
+func (s *Service) Put(key string) { // want `aspects.Log.Before uses ParamTo\(2\), Put has 1 params`
+}
+
+//@Transactional
+func (s *Service) Save() { // want `aspects.Trans.Around uses ResultTo\(1\), Save has 0 results`
+}
+
+// want `annotation @Retry does not match any custom aspect`
+//@Retry
+func (s *Service) Load() {}
+
+//@Pointcut("log")
+func Helper(key string) { // want `@Pointcut on function Helper without receiver`
+}
+
+//@Proxy("IHidden")
+type hidden struct{} // want `@Proxy on unexported type hidden`
+
+//@Proxy("IName")
+type Name string // want `@Proxy on non-struct type Name`
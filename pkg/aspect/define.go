@@ -3,6 +3,8 @@ package aspect
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
 	"strings"
 )
 
@@ -40,6 +42,10 @@ type (
 		Fields() []Field
 		Option() string
 		IsSingleton() bool
+		// Template is the path of a custom proxy template, empty for the default one
+		Template() string
+		// TypeParams of a generic struct, nil otherwise
+		TypeParams() *ast.FieldList
 	}
 	// Component
 	Component interface {
@@ -48,6 +54,10 @@ type (
 		PkgPath() string
 		PkgName() string
 		Factory() (string, string, string)
+		// IsGeneric reports a factory with type parameters, instantiated with the type arguments of the injected field
+		IsGeneric() bool
+		// File declares the factory, or the proxied struct of a generated factory, empty if it is unknown
+		File() string
 	}
 	// Field
 	Field interface {
@@ -65,18 +75,28 @@ type (
 		Nameable
 		Cutable
 		Cloneable[method]
+		Func() *ast.FuncDecl
 		GetParams() ([]string, []string)
 		GetResults() ([]string, []string)
+		// Imports are needed by the types of params and results, empty without Signature
+		Imports() []*ast.ImportSpec
+		// IsVariadic reports whether the last param is ...T, which is forwarded as args...
+		IsVariadic() bool
+		// Types is the type checked signature, nil without Signature
+		Types() *types.Signature
 	}
 	// Pointcut
 	Pointcut interface {
 		Nameable
+		Pos() token.Pos
 	}
 
 	// Advice
 	Advice interface {
 		Nameable
 		Func() *ast.FuncDecl
+		// TypesInfo of the package of the advice, nil if it was not type checked
+		TypesInfo() *types.Info
 	}
 
 	// Aspect
@@ -89,12 +109,19 @@ type (
 		GetAfter() Advice
 		GetAround() Advice
 		Imports() []*ast.ImportSpec
+		PkgPath() string
+		PkgName() string
+		// Mode is how advice is woven, empty for the default of the generator
+		Mode() AdviceMode
+		SetMode(AdviceMode)
 	}
 
 	// Joinpoint
 	Joinpoint interface {
 		Nameable
+		// ParamTo is the i-th param from 1, a variadic param is its slice, []T
 		ParamTo(i int) any
+		// Params in order of declaration, a variadic param is one element, the slice of its arguments
 		Params() []any
 		Results() []any
 		ResultTo(i int) any
@@ -108,21 +135,45 @@ type (
 	}
 )
 
+// AdviceMode is how the advice of an aspect is woven into proxy methods.
+type AdviceMode string
+
+const (
+	// ModeInline inlines the statements of advice, with Joinpoint calls substituted
+	ModeInline AdviceMode = "inline"
+	// ModeCall calls the advice methods of an aspect instance with an Invocation
+	ModeCall AdviceMode = "call"
+)
+
+// Signature is a method signature rendered from type information, which GetParams and GetResults
+// return instead of the declaration in source form.
+type Signature struct {
+	ParamNames  []string
+	Params      []string // declaration, a int, b ...string
+	ResultNames []string
+	Results     []string // declaration with names, r0 int, r1 error
+	Imports     []*ast.ImportSpec
+	Variadic    bool
+	Types       *types.Signature
+}
+
 type (
 	// implement Proxy
 	proxy struct {
-		pkgPath   string
-		pkgName   string
-		name      string
-		methods   []Method
-		pointcuts []Pointcut
-		imports   []*ast.ImportSpec
-		docs      *ast.CommentGroup
-		abstract  string
-		suffix    string
-		fields    []Field
-		option    string
-		singleton bool
+		pkgPath    string
+		pkgName    string
+		name       string
+		methods    []Method
+		pointcuts  []Pointcut
+		imports    []*ast.ImportSpec
+		docs       *ast.CommentGroup
+		abstract   string
+		suffix     string
+		fields     []Field
+		option     string
+		singleton  bool
+		template   string
+		typeParams *ast.FieldList
 	}
 	// implement Method
 	method struct {
@@ -130,6 +181,7 @@ type (
 		f         *ast.FuncDecl
 		params    *ast.FieldList
 		results   *ast.FieldList
+		signature *Signature
 		pointcuts []Pointcut
 	}
 	// implement component
@@ -139,19 +191,26 @@ type (
 		pkgName     string
 		factoryPkg  string
 		factoryName string
+		generic     bool
+		file        string
 	}
 	// implement Pointcut
 	pointcut struct {
 		name string
+		pos  token.Pos
 	}
 	// implement Advice
 	advice struct {
 		name string
 		f    *ast.FuncDecl
+		info *types.Info
 	}
 	// implement Aspect
 	aspect struct {
 		name    string
+		pkgPath string
+		pkgName string
+		mode    AdviceMode
 		before  Advice
 		after   Advice
 		around  Advice
@@ -236,10 +295,14 @@ func (p *advice) Name() string    { return p.name }
 func (p *component) Name() string { return p.name }
 func (p *field) Name() string     { return p.name }
 
+func (p *pointcut) Pos() token.Pos { return p.pos }
+
 func (p *proxy) PkgPath() string     { return p.pkgPath }
 func (p *proxy) PkgName() string     { return p.pkgName }
 func (p *component) PkgPath() string { return p.pkgPath }
 func (p *component) PkgName() string { return p.pkgName }
+func (p *aspect) PkgPath() string    { return p.pkgPath }
+func (p *aspect) PkgName() string    { return p.pkgName }
 
 func (p *field) TPkg() string   { return p.tPkg }
 func (p *field) Define() string { return p.name + " " + p.typ }
@@ -262,6 +325,13 @@ func (p *proxy) Option() string              { return p.option }
 func (p *proxy) AddFields(list ...Field)     { p.fields = append(p.fields, list...) }
 func (p *proxy) Fields() []Field             { return p.fields }
 func (p *proxy) IsSingleton() bool           { return p.singleton }
+func (p *proxy) Template() string            { return p.template }
+func (p *proxy) TypeParams() *ast.FieldList  { return p.typeParams }
+func (p *component) IsGeneric() bool         { return p.generic }
+func (p *component) File() string            { return p.file }
+
+func (p *aspect) Mode() AdviceMode     { return p.mode }
+func (p *aspect) SetMode(m AdviceMode) { p.mode = m }
 
 func (p *aspect) GetBefore() Advice {
 	return p.before
@@ -287,16 +357,49 @@ func (p *aspect) SetAround(around Advice) {
 	p.around = around
 }
 
-func (p *advice) Func() *ast.FuncDecl { return p.f }
+func (p *advice) Func() *ast.FuncDecl    { return p.f }
+func (p *advice) TypesInfo() *types.Info { return p.info }
+func (p *method) Func() *ast.FuncDecl    { return p.f }
 
 func (p *method) GetParams() ([]string, []string) {
+	if p.signature != nil {
+		return p.signature.ParamNames, p.signature.Params
+	}
 	return p.parseFields(p.params)
 }
 
 func (p *method) GetResults() ([]string, []string) {
+	if p.signature != nil {
+		return p.signature.ResultNames, p.signature.Results
+	}
 	return p.parseFields(p.results)
 }
 
+func (p *method) IsVariadic() bool {
+	if p.signature != nil {
+		return p.signature.Variadic
+	}
+	if p.params == nil || len(p.params.List) == 0 {
+		return false
+	}
+	_, ok := p.params.List[len(p.params.List)-1].Type.(*ast.Ellipsis)
+	return ok
+}
+
+func (p *method) Imports() []*ast.ImportSpec {
+	if p.signature != nil {
+		return p.signature.Imports
+	}
+	return nil
+}
+
+func (p *method) Types() *types.Signature {
+	if p.signature != nil {
+		return p.signature.Types
+	}
+	return nil
+}
+
 func (p *method) parseFields(paramOrResult *ast.FieldList) ([]string, []string) {
 	var paramNames, params []string
 	if paramOrResult == nil {
@@ -311,37 +414,8 @@ func (p *method) parseFields(paramOrResult *ast.FieldList) ([]string, []string)
 			names = append(names, fmt.Sprintf("r%d", i))
 		}
 		paramNames = append(paramNames, names...)
-		var paramType string
-		if ident, ok := param.Type.(*ast.Ident); ok {
-			paramType = ident.Name
-		}
-		if star, ok := param.Type.(*ast.StarExpr); ok {
-			paramType = "*"
-			typePkg := ""
-			ident, ok := star.X.(*ast.Ident)
-			if !ok {
-				if sleExpr, ok := star.X.(*ast.SelectorExpr); ok {
-					typePkg = sleExpr.X.(*ast.Ident).Name
-					ident = sleExpr.Sel
-				}
-			}
-			if len(typePkg) > 0 {
-				paramType += typePkg + "."
-			}
-			paramType += ident.Name
-		}
-		if inter, ok := param.Type.(*ast.InterfaceType); ok {
-			paramType = "interface{%s}"
-			var methods []string
-			// todo fill interface methods
-			for _, v := range inter.Methods.List {
-				_ = v
-			}
-			paramType = fmt.Sprintf(paramType, strings.Join(methods, "\n"))
-		}
-		if sel, ok := param.Type.(*ast.SelectorExpr); ok {
-			paramType = fmt.Sprintf("%s.%s", sel.X.(*ast.Ident).Name, sel.Sel.Name)
-		}
+		// source form, type parameters and instantiated generic types included
+		paramType := types.ExprString(param.Type)
 		pa := fmt.Sprintf("%s %s",
 			strings.Join(names, ","), paramType,
 		)
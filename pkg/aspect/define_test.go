@@ -0,0 +1,56 @@
+package aspect
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethod_declaration(t *testing.T) {
+	tests := []struct {
+		src             string
+		paramNames      []string
+		params, results []string
+		variadic        bool
+	}{
+		{
+			src:        "func (s *S) Log(ctx context.Context, args ...any)",
+			paramNames: []string{"ctx", "args"},
+			params:     []string{"ctx context.Context", "args ...any"},
+			variadic:   true,
+		},
+		{
+			src:        "func (s *S) Join(sep string, parts ...[]byte) string",
+			paramNames: []string{"sep", "parts"},
+			params:     []string{"sep string", "parts ...[]byte"},
+			results:    []string{"r0 string"},
+			variadic:   true,
+		},
+		{
+			src:        "func (s *S) Sum(a, b int, nums []int) (n int, err error)",
+			paramNames: []string{"a", "b", "nums"},
+			params:     []string{"a,b int", "nums []int"},
+			results:    []string{"n int", "err error"},
+		},
+		{
+			src: "func (s *S) None()",
+		},
+	}
+	for _, tt := range tests {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n\n"+tt.src+" {}\n", 0)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		m := NewMethod(WithMethodDecl(file.Decls[0].(*ast.FuncDecl)))
+		names, params := m.GetParams()
+		_, results := m.GetResults()
+		assert.Equal(t, tt.paramNames, names, tt.src)
+		assert.Equal(t, tt.params, params, tt.src)
+		assert.Equal(t, tt.results, results, tt.src)
+		assert.Equal(t, tt.variadic, m.IsVariadic(), tt.src)
+		assert.Nil(t, m.Types(), tt.src)
+	}
+}
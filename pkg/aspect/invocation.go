@@ -0,0 +1,216 @@
+package aspect
+
+import (
+	"context"
+	"sync"
+)
+
+var _ ProceedingJoinpoint = (*Invocation)(nil)
+
+var invocationPool = sync.Pool{New: func() any { return &Invocation{} }}
+
+// Invocation is the runtime Joinpoint and ProceedingJoinpoint of a method call. Proxies pass it
+// to the advice of aspects woven in call mode, and hand-written decorators run a Chain with it.
+// Advice takes it as a Joinpoint and asserts *Invocation for the receiver, context and annotations.
+type Invocation struct {
+	name        string
+	receiver    any
+	ctx         context.Context
+	params      []any
+	results     []any
+	annotations []string
+	chain       Chain
+	pos         int // index of the next interceptor of chain
+	target      func(args ...any) []any
+	pooled      bool
+}
+
+// NewInvocation returns the joinpoint of a call of the method name with params,
+// a variadic param is one element, the slice of its arguments.
+func NewInvocation(name string, params ...any) *Invocation {
+	i := &Invocation{}
+	i.reset(name, nil, params)
+	return i
+}
+
+// AcquireInvocation is NewInvocation of a method of receiver from a pool, params are copied.
+// Release returns it once the call and its advice are done.
+func AcquireInvocation(name string, receiver any, params ...any) *Invocation {
+	i := invocationPool.Get().(*Invocation)
+	i.pooled = true
+	i.reset(name, receiver, params)
+	return i
+}
+
+// Release returns an acquired invocation to the pool, it must not be used afterwards.
+// Invocations of NewInvocation are left to the garbage collector.
+func (i *Invocation) Release() {
+	if !i.pooled {
+		return
+	}
+	i.reset("", nil, nil)
+	i.results = setList(i.results, nil)
+	clear(i.annotations)
+	i.annotations = i.annotations[:0]
+	invocationPool.Put(i)
+}
+
+func (i *Invocation) reset(name string, receiver any, params []any) {
+	i.name = name
+	i.receiver = receiver
+	i.params = setList(i.params, params)
+	i.ctx = nil
+	i.chain = nil
+	i.pos = 0
+	i.target = nil
+	// a context as first param is the context of the call
+	if len(params) > 0 {
+		i.ctx, _ = params[0].(context.Context)
+	}
+}
+
+// WithProceed sets target, the method, called by Proceed at the end of the chain with
+// the params, replaced by the arguments of Proceed if there are any.
+func (i *Invocation) WithProceed(target func(args ...any) []any) *Invocation {
+	i.target = target
+	return i
+}
+
+// WithReceiver sets the value whose method is called.
+func (i *Invocation) WithReceiver(receiver any) *Invocation {
+	i.receiver = receiver
+	return i
+}
+
+// WithContext sets the context of the call, the first param if it is a context by default.
+func (i *Invocation) WithContext(ctx context.Context) *Invocation {
+	i.ctx = ctx
+	return i
+}
+
+// WithAnnotations sets the annotations of the method, like the names of its pointcuts.
+func (i *Invocation) WithAnnotations(annotations ...string) *Invocation {
+	i.annotations = append(i.annotations[:0], annotations...)
+	return i
+}
+
+func (i *Invocation) Name() string          { return i.name }
+func (i *Invocation) FuncName() string      { return i.name }
+func (i *Invocation) Receiver() any         { return i.receiver }
+func (i *Invocation) Annotations() []string { return i.annotations }
+
+// Params and Results return the storage of the invocation, which Proceed overwrites and Release clears
+// for the next acquired invocation, copy them to keep them.
+func (i *Invocation) Params() []any  { return i.params }
+func (i *Invocation) Results() []any { return i.results }
+
+// Context of the call, context.Background if there is none.
+func (i *Invocation) Context() context.Context {
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
+}
+
+// HasAnnotation reports whether the method has the annotation name.
+func (i *Invocation) HasAnnotation(name string) bool {
+	for _, v := range i.annotations {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParamTo is the i-th param from 1, nil if it is out of range.
+func (i *Invocation) ParamTo(n int) any { return at(i.params, n) }
+
+// ResultTo is the i-th result from 1, nil if it is out of range or there are no results yet.
+func (i *Invocation) ResultTo(n int) any { return at(i.results, n) }
+
+// SetResults records the results of the call, which after advice observes.
+func (i *Invocation) SetResults(results ...any) {
+	i.results = setList(i.results, results)
+}
+
+// Proceed calls the next interceptor of the chain, or the target after the last one, with args
+// instead of the params if there are any, and returns the results, nil without a target.
+// An interceptor may proceed more than once, each time the rest of the chain runs again.
+// The results are Results, the slice is reused by the next Proceed and cleared by Release.
+func (i *Invocation) Proceed(args ...any) []any {
+	if len(args) > 0 {
+		i.params = setList(i.params, args)
+	}
+	if i.pos < len(i.chain) {
+		pos := i.pos
+		i.pos++
+		results := i.chain[pos](i)
+		i.pos = pos
+		i.SetResults(results...)
+		return i.results
+	}
+	if i.target == nil {
+		return nil
+	}
+	i.SetResults(i.target(i.params...)...)
+	return i.results
+}
+
+// Interceptor is around advice at runtime, it returns the results of the call, usually those of Proceed.
+type Interceptor func(pjp ProceedingJoinpoint) []any
+
+// Chain runs interceptors in order around a target, the first one is the outermost.
+type Chain []Interceptor
+
+// NewChain returns the chain of interceptors, nil ones are skipped.
+func NewChain(interceptors ...Interceptor) Chain {
+	c := make(Chain, 0, len(interceptors))
+	for _, v := range interceptors {
+		if v != nil {
+			c = append(c, v)
+		}
+	}
+	return c
+}
+
+// Invoke runs the chain with inv around target and returns the results, which are those of
+// inv.Results, read them before inv is released.
+func (c Chain) Invoke(inv *Invocation, target func(args ...any) []any) []any {
+	inv.chain, inv.pos, inv.target = c, 0, target
+	return inv.Proceed()
+}
+
+// BeforeAdvice is the interceptor calling advice before the rest of the chain.
+func BeforeAdvice(advice func(jp Joinpoint)) Interceptor {
+	return func(pjp ProceedingJoinpoint) []any {
+		advice(pjp)
+		return pjp.Proceed()
+	}
+}
+
+// AfterAdvice is the interceptor calling advice once the rest of the chain returns, with its results.
+func AfterAdvice(advice func(jp Joinpoint)) Interceptor {
+	return func(pjp ProceedingJoinpoint) []any {
+		results := pjp.Proceed()
+		advice(pjp)
+		return results
+	}
+}
+
+func at(list []any, n int) any {
+	if n < 1 || n > len(list) {
+		return nil
+	}
+	return list[n-1]
+}
+
+// setList copies values into list, which may share their array, and drops the references
+// to elements of list beyond them.
+func setList(list, values []any) []any {
+	n := len(list)
+	list = append(list[:0], values...)
+	if n > len(list) {
+		clear(list[len(list):n])
+	}
+	return list
+}
@@ -0,0 +1,113 @@
+package aspect
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	var trace []string
+	tracer := func(name string) Interceptor {
+		return func(pjp ProceedingJoinpoint) []any {
+			trace = append(trace, name+" before")
+			results := pjp.Proceed()
+			trace = append(trace, name+" after")
+			return results
+		}
+	}
+	upper := func(pjp ProceedingJoinpoint) []any {
+		return pjp.Proceed(strings.ToUpper(pjp.ParamTo(1).(string)))
+	}
+	target := func(args ...any) []any {
+		trace = append(trace, "target")
+		return []any{"hi " + args[0].(string), nil}
+	}
+
+	inv := NewInvocation("Greet", "bob")
+	results := NewChain(tracer("outer"), nil, upper, tracer("inner")).Invoke(inv, target)
+	assert.Equal(t, []any{"hi BOB", nil}, results)
+	assert.Equal(t, []any{"BOB"}, inv.Params())
+	assert.Equal(t, "hi BOB", inv.ResultTo(1))
+	assert.Nil(t, inv.ResultTo(3))
+	assert.Equal(t, []string{"outer before", "inner before", "target", "inner after", "outer after"}, trace)
+}
+
+func TestChain_retry(t *testing.T) {
+	calls := 0
+	retry := func(pjp ProceedingJoinpoint) []any {
+		results := pjp.Proceed()
+		for i := 0; i < 2 && results[0] != nil; i++ {
+			results = pjp.Proceed()
+		}
+		return results
+	}
+	target := func(args ...any) []any {
+		calls++
+		if calls < 3 {
+			return []any{fmt.Errorf("call %d", calls)}
+		}
+		return []any{nil}
+	}
+	results := NewChain(retry).Invoke(NewInvocation("Save"), target)
+	assert.Equal(t, []any{nil}, results)
+	assert.Equal(t, 3, calls)
+}
+
+func TestAcquireInvocation(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "v")
+	recv := &struct{}{}
+	inv := AcquireInvocation("Get", recv, ctx, 1).WithAnnotations("log", "@Transactional")
+	assert.Equal(t, "Get", inv.FuncName())
+	assert.Same(t, recv, inv.Receiver())
+	assert.Equal(t, "v", inv.Context().Value(key{}))
+	assert.True(t, inv.HasAnnotation("@Transactional"))
+	assert.False(t, inv.HasAnnotation("trace"))
+	inv.SetResults("a", nil)
+	inv.Release()
+
+	inv = AcquireInvocation("Put", nil, 2)
+	defer inv.Release()
+	assert.Equal(t, []any{2}, inv.Params())
+	assert.Empty(t, inv.Results())
+	assert.Empty(t, inv.Annotations())
+	assert.Nil(t, inv.Receiver())
+	assert.Equal(t, context.Background(), inv.Context())
+	assert.Nil(t, inv.Proceed())
+}
+
+func TestAcquireInvocation_allocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		inv := AcquireInvocation("Get", nil, 1, "a").WithAnnotations("log")
+		inv.SetResults(true)
+		inv.Release()
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestBeforeAdvice_AfterAdvice(t *testing.T) {
+	var trace []string
+	advice := func(name string) func(Joinpoint) {
+		return func(jp Joinpoint) {
+			trace = append(trace, fmt.Sprintf("%s %v %v", name, jp.Params(), jp.Results()))
+		}
+	}
+	around := func(pjp ProceedingJoinpoint) []any {
+		trace = append(trace, "around")
+		return pjp.Proceed(pjp.ParamTo(1).(int) + 1)
+	}
+	target := func(args ...any) []any {
+		trace = append(trace, "target")
+		return []any{args[0].(int) * 2}
+	}
+
+	inv := AcquireInvocation("Double", nil, 1)
+	defer inv.Release()
+	results := NewChain(AfterAdvice(advice("after")), around, BeforeAdvice(advice("before"))).Invoke(inv, target)
+	assert.Equal(t, []any{4}, results)
+	assert.Equal(t, []string{"around", "before [2] []", "target", "after [2] [4]"}, trace)
+}
@@ -2,6 +2,8 @@ package aspect
 
 import (
 	"go/ast"
+	"go/token"
+	"go/types"
 	"strings"
 )
 
@@ -62,6 +64,18 @@ func WithProxyMode(s bool) ProxyOption {
 	}
 }
 
+func WithProxyTemplate(path string) ProxyOption {
+	return func(o *proxy) {
+		o.template = path
+	}
+}
+
+func WithProxyTypeParams(params *ast.FieldList) ProxyOption {
+	return func(o *proxy) {
+		o.typeParams = params
+	}
+}
+
 func WithProxyPointcuts(po ...Pointcut) ProxyOption {
 	return func(o *proxy) {
 		o.pointcuts = append(o.pointcuts, po...)
@@ -80,12 +94,31 @@ func WithAspectImports(specs []*ast.ImportSpec) Option[aspect] {
 	}
 }
 
+func WithAspectPkg(path, name string) Option[aspect] {
+	return func(o *aspect) {
+		o.pkgPath = path
+		o.pkgName = name
+	}
+}
+
+func WithAspectMode(mode AdviceMode) Option[aspect] {
+	return func(o *aspect) {
+		o.mode = mode
+	}
+}
+
 func WithPointcutName(name string) PointcutOption {
 	return func(o *pointcut) {
 		o.name = name
 	}
 }
 
+func WithPointcutPos(pos token.Pos) PointcutOption {
+	return func(o *pointcut) {
+		o.pos = pos
+	}
+}
+
 func WithAdviceName(name string) Option[advice] {
 	return func(o *advice) {
 		o.name = name
@@ -99,6 +132,12 @@ func WithAdviceDecl(decl *ast.FuncDecl) Option[advice] {
 	}
 }
 
+func WithAdviceTypesInfo(info *types.Info) Option[advice] {
+	return func(o *advice) {
+		o.info = info
+	}
+}
+
 func WithMethodName(name string) MethodOption {
 	return func(o *method) {
 		o.name = name
@@ -117,6 +156,12 @@ func WithMethodResults(results *ast.FieldList) MethodOption {
 	}
 }
 
+func WithMethodSignature(sig *Signature) MethodOption {
+	return func(o *method) {
+		o.signature = sig
+	}
+}
+
 func WithMethodDecl(decl *ast.FuncDecl) MethodOption {
 	return func(o *method) {
 		o.f = decl
@@ -146,6 +191,18 @@ func WithComponentFactory(pkg, name string) Option[component] {
 	}
 }
 
+func WithComponentFile(name string) Option[component] {
+	return func(c *component) {
+		c.file = name
+	}
+}
+
+func WithComponentGeneric(generic bool) Option[component] {
+	return func(c *component) {
+		c.generic = generic
+	}
+}
+
 func WithFieldName(name string) FieldOption {
 	return func(c *field) {
 		c.name = name
@@ -33,16 +33,28 @@ const (
 	CommentKeyCustom    = AnnotationKey("custom")
 	CommentKeyOption    = AnnotationKey("option")
 	CommentKeySingleton = AnnotationKey("singleton")
+	// CommentKeyTemplate custom template file of @Proxy, relative to the package directory
+	CommentKeyTemplate = AnnotationKey("template")
+	// CommentKeyMode how advice of @Aspect is woven, inline or call
+	CommentKeyMode = AnnotationKey("mode")
 )
 
 var (
 	adviceAnnotationList = []Annotation{CommentAdviceBefore, CommentAdviceAfter, CommentAdviceAround}
 	allAnnotationKey     = map[AnnotationKey]struct{}{
-		CommentKeyDefault:  {},
-		CommentKeyAbstract: {},
-		CommentKeySuffix:   {},
-		CommentKeyCustom:   {},
-		CommentKeyOption:   {},
+		CommentKeyDefault:   {},
+		CommentKeyAbstract:  {},
+		CommentKeySuffix:    {},
+		CommentKeyCustom:    {},
+		CommentKeyOption:    {},
+		CommentKeySingleton: {},
+		CommentKeyTemplate:  {},
+		CommentKeyMode:      {},
+	}
+	// keys accepted by system annotations besides the default one
+	annotationKeys = map[Annotation][]AnnotationKey{
+		CommentProxy:  {CommentKeyAbstract, CommentKeySuffix, CommentKeyOption, CommentKeySingleton, CommentKeyTemplate},
+		CommentAspect: {CommentKeyCustom, CommentKeyMode},
 	}
 	systemAnnotation = map[Annotation]struct{}{
 		CommentProxy:        {},
@@ -69,3 +81,16 @@ func IsSystemAnnotationKey(key AnnotationKey) bool {
 	_, ok := allAnnotationKey[key]
 	return ok
 }
+
+// IsAnnotationKey reports whether key is accepted by anno, keys of custom annotations are not checked.
+func IsAnnotationKey(anno Annotation, key AnnotationKey) bool {
+	if key == CommentKeyDefault || !IsSystemAnnotation(anno) {
+		return true
+	}
+	for _, v := range annotationKeys[anno] {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package astutils
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+// runtimeAlias is the name proxies calling advice import the runtime joinpoint with,
+// which does not collide with packages of aspects named aspect.
+const runtimeAlias = "sandwich"
+
+// RuntimeImport is the import of the runtime joinpoint by proxies calling advice.
+func RuntimeImport() *ProxyImport {
+	return &ProxyImport{Alias: runtimeAlias, Path: `"` + aspectPkgPath + `"`}
+}
+
+// InvocationStmt acquires jp, the runtime joinpoint of a call of method on the parent with its params
+// and annotations, which is released when the proxy method returns.
+func InvocationStmt(jp string, method aspect.Method, annotations []string) []string {
+	names, _ := method.GetParams()
+	args := append([]string{strconv.Quote(method.Name()), "p.parent"}, names...)
+	stmt := fmt.Sprintf("%s := %s.AcquireInvocation(%s)", jp, runtimeAlias, strings.Join(args, ", "))
+	if len(annotations) > 0 {
+		quoted := make([]string, len(annotations))
+		for i, v := range annotations {
+			quoted[i] = strconv.Quote(v)
+		}
+		stmt += fmt.Sprintf(".WithAnnotations(%s)", strings.Join(quoted, ", "))
+	}
+	return []string{stmt, "defer " + jp + ".Release()"}
+}
+
+// ChainStmt returns the statements invoking the chain of interceptors, the advice of call mode, with
+// the joinpoint jp before and after the rest of the method, which is the target of the chain.
+// Arguments of Proceed replace the params and the results of the chain replace those of method,
+// if their numbers match.
+func ChainStmt(jp string, interceptors []string, method aspect.Method, scope *Scope) ([]string, []string) {
+	paramNames, params := method.GetParams()
+	resultNames, results := method.GetResults()
+	args := scope.Declare("args")
+	call := fmt.Sprintf("%s.NewChain(%s).Invoke(%s, func(%s ...any) []any {",
+		runtimeAlias, strings.Join(interceptors, ", "), jp, args)
+	var res string
+	if len(resultNames) > 0 {
+		res = scope.Declare("results")
+		call = res + " := " + call
+	}
+	before := []string{call}
+	if len(paramNames) > 0 {
+		before = append(before, assertStmt(args, paramNames, declTypes(params, method.IsVariadic())))
+	}
+	after := []string{"return nil", "})"}
+	if len(resultNames) > 0 {
+		after = []string{
+			fmt.Sprintf("return []any{%s}", strings.Join(resultNames, ", ")),
+			"})",
+			assertStmt(res, resultNames, declTypes(results, false)),
+		}
+	}
+	return before, after
+}
+
+// CallInterceptor returns the interceptor calling advice, annotated by kind, on recv, the aspect
+// instance. Around advice taking a ProceedingJoinpoint is the interceptor itself, before and after
+// advice are adapted by BeforeAdvice and AfterAdvice, other advice is wrapped in a function literal.
+func CallInterceptor(advice aspect.Advice, recv string, kind Annotation) (string, error) {
+	around := kind == CommentAdviceAround
+	if err := checkCallable(advice, around); err != nil {
+		return "", err
+	}
+	param := joinpointParam(advice)
+	if around {
+		switch param {
+		case "ProceedingJoinpoint":
+			return callee(advice, recv), nil
+		case "Joinpoint":
+			return fmt.Sprintf("func(pjp %s.ProceedingJoinpoint) []any { return %s(pjp) }", runtimeAlias, callee(advice, recv)), nil
+		}
+		return fmt.Sprintf("func(%s.ProceedingJoinpoint) []any { return %s() }", runtimeAlias, callee(advice, recv)), nil
+	}
+	adapter := runtimeAlias + ".BeforeAdvice"
+	if kind == CommentAdviceAfter {
+		adapter = runtimeAlias + ".AfterAdvice"
+	}
+	switch param {
+	case "Joinpoint":
+		return fmt.Sprintf("%s(%s)", adapter, callee(advice, recv)), nil
+	case "ProceedingJoinpoint":
+		return fmt.Sprintf("%s(func(jp %s.Joinpoint) { %s(jp.(%s.ProceedingJoinpoint)) })",
+			adapter, runtimeAlias, callee(advice, recv), runtimeAlias), nil
+	}
+	return fmt.Sprintf("%s(func(%s.Joinpoint) { %s() })", adapter, runtimeAlias, callee(advice, recv)), nil
+}
+
+// AdviceReturnsEarly reports whether advice returns before its last statement, such inlined
+// around advice returns from the proxy method and cannot be nested in called advice.
+func AdviceReturnsEarly(advice aspect.Advice) bool {
+	body := adviceBody(advice)
+	if body == nil {
+		return false
+	}
+	returns := adviceReturns(body)
+	if n := len(body.List); n > 0 {
+		if ret, ok := body.List[n-1].(*ast.ReturnStmt); ok {
+			delete(returns, ret)
+		}
+	}
+	return len(returns) > 0
+}
+
+func callee(advice aspect.Advice, recv string) string {
+	return recv + "." + advice.Func().Name.Name
+}
+
+// assertStmt assigns the elements of list to names if their numbers match, asserted as types.
+func assertStmt(list string, names, types []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "if len(%s) == %d {\n", list, len(names))
+	for i, v := range names {
+		fmt.Fprintf(&b, "%s, _ = %s[%d].(%s)\n", v, list, i, types[i])
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// declTypes returns the type of every name declared by decls, like a, b int, a variadic
+// param as its slice.
+func declTypes(decls []string, variadic bool) []string {
+	var list []string
+	for i, v := range decls {
+		names, typ, _ := strings.Cut(v, " ")
+		typ = strings.TrimSpace(typ)
+		if variadic && i == len(decls)-1 {
+			typ = "[]" + strings.TrimPrefix(typ, "...")
+		}
+		for range strings.Split(names, ",") {
+			list = append(list, typ)
+		}
+	}
+	return list
+}
+
+// checkCallable reports advice which cannot be called with a runtime joinpoint: it takes a Joinpoint
+// or ProceedingJoinpoint, or nothing, and around advice returns []any.
+func checkCallable(advice aspect.Advice, around bool) error {
+	decl := advice.Func()
+	params := decl.Type.Params
+	if n := params.NumFields(); n > 1 || (n == 1 && len(joinpointName(advice, params.List[0].Type)) == 0) {
+		return fmt.Errorf("advice %s is called with a joinpoint, it takes aspect.Joinpoint or aspect.ProceedingJoinpoint only", decl.Name.Name)
+	}
+	if around {
+		results := decl.Type.Results
+		if results.NumFields() != 1 || !isAnySlice(results.List[0].Type) {
+			return fmt.Errorf("around advice %s is called with a joinpoint, it returns []any", decl.Name.Name)
+		}
+	}
+	return nil
+}
+
+// joinpointParam returns Joinpoint or ProceedingJoinpoint, the type of the param of callable advice,
+// empty if it takes none.
+func joinpointParam(advice aspect.Advice) string {
+	params := advice.Func().Type.Params
+	if params.NumFields() == 0 {
+		return ""
+	}
+	return joinpointName(advice, params.List[0].Type)
+}
+
+// joinpointName returns Joinpoint or ProceedingJoinpoint if expr is one of them, empty otherwise,
+// by type information if the package of advice was type checked.
+func joinpointName(advice aspect.Advice, expr ast.Expr) string {
+	if info := advice.TypesInfo(); info != nil {
+		if tv, ok := info.Types[expr]; ok {
+			if !isJoinpointType(tv.Type) {
+				return ""
+			}
+			return types.Unalias(tv.Type).(*types.Named).Obj().Name()
+		}
+	}
+	name := types.ExprString(expr)
+	switch {
+	case strings.HasSuffix(name, "ProceedingJoinpoint"):
+		return "ProceedingJoinpoint"
+	case strings.HasSuffix(name, "Joinpoint"):
+		return "Joinpoint"
+	}
+	return ""
+}
@@ -0,0 +1,173 @@
+package astutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_declTypes(t *testing.T) {
+	tests := []struct {
+		decls    []string
+		variadic bool
+		want     []string
+	}{
+		{decls: []string{"ctx context.Context", "args ...any"}, variadic: true, want: []string{"context.Context", "[]any"}},
+		{decls: []string{"parts ...[]byte"}, variadic: true, want: []string{"[][]byte"}},
+		{decls: []string{"a,b int", "fn func(a, b int) error"}, want: []string{"int", "int", "func(a, b int) error"}},
+		{decls: []string{"r0 string", "r1 error"}, want: []string{"string", "error"}},
+		{decls: nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, declTypes(tt.decls, tt.variadic), tt.decls)
+	}
+}
+
+func TestCallInterceptor(t *testing.T) {
+	const header = `import (
+	"context"
+
+	ap "github.com/go-park/sandwich/pkg/aspect"
+)
+
+var (
+	_ = context.Background
+	_ ap.Joinpoint
+)
+
+type A struct{}
+
+type Joinpoint interface{ FuncName() string }
+
+func (s *A) M() {}
+`
+	tests := []struct {
+		name string
+		src  string
+		kind Annotation
+		want string
+		err  string
+	}{
+		{
+			name: "around",
+			src:  `func (a *A) Advice(pjp ap.ProceedingJoinpoint) []any { return pjp.Proceed() }`,
+			kind: CommentAdviceAround,
+			want: "p.a.Advice",
+		},
+		{
+			name: "around taking a joinpoint",
+			src:  `func (a *A) Advice(jp ap.Joinpoint) []any { return nil }`,
+			kind: CommentAdviceAround,
+			want: "func(pjp sandwich.ProceedingJoinpoint) []any { return p.a.Advice(pjp) }",
+		},
+		{
+			name: "around taking nothing",
+			src:  `func (a *A) Advice() []any { return nil }`,
+			kind: CommentAdviceAround,
+			want: "func(sandwich.ProceedingJoinpoint) []any { return p.a.Advice() }",
+		},
+		{
+			name: "around without results",
+			src:  `func (a *A) Advice(pjp ap.ProceedingJoinpoint) { pjp.Proceed() }`,
+			kind: CommentAdviceAround,
+			err:  "around advice Advice is called with a joinpoint, it returns []any",
+		},
+		{
+			name: "around returning other results",
+			src:  `func (a *A) Advice(pjp ap.ProceedingJoinpoint) ([]any, error) { return nil, nil }`,
+			kind: CommentAdviceAround,
+			err:  "around advice Advice is called with a joinpoint, it returns []any",
+		},
+		{
+			name: "before",
+			src:  `func (a *A) Advice(jp ap.Joinpoint) {}`,
+			kind: CommentAdviceBefore,
+			want: "sandwich.BeforeAdvice(p.a.Advice)",
+		},
+		{
+			name: "before taking a proceeding joinpoint",
+			src:  `func (a *A) Advice(pjp ap.ProceedingJoinpoint) {}`,
+			kind: CommentAdviceBefore,
+			want: "sandwich.BeforeAdvice(func(jp sandwich.Joinpoint) { p.a.Advice(jp.(sandwich.ProceedingJoinpoint)) })",
+		},
+		{
+			name: "after taking nothing",
+			src:  `func (a *A) Advice() {}`,
+			kind: CommentAdviceAfter,
+			want: "sandwich.AfterAdvice(func(sandwich.Joinpoint) { p.a.Advice() })",
+		},
+		{
+			name: "after taking a joinpoint of another package",
+			src:  `func (a *A) Advice(jp Joinpoint) {}`,
+			kind: CommentAdviceAfter,
+			err:  "advice Advice is called with a joinpoint, it takes aspect.Joinpoint or aspect.ProceedingJoinpoint only",
+		},
+		{
+			name: "before taking a context",
+			src:  `func (a *A) Advice(ctx context.Context) {}`,
+			kind: CommentAdviceBefore,
+			err:  "advice Advice is called with a joinpoint, it takes aspect.Joinpoint or aspect.ProceedingJoinpoint only",
+		},
+		{
+			name: "before taking two params",
+			src:  `func (a *A) Advice(jp ap.Joinpoint, ctx context.Context) {}`,
+			kind: CommentAdviceBefore,
+			err:  "advice Advice is called with a joinpoint, it takes aspect.Joinpoint or aspect.ProceedingJoinpoint only",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, advice := parseAdvice(t, header+tt.src+"\n")
+			got, err := CallInterceptor(advice["Advice"], "p.a", tt.kind)
+			if len(tt.err) > 0 {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestChainStmt(t *testing.T) {
+	tests := []struct {
+		name          string
+		src           string
+		before, after string
+	}{
+		{
+			name: "params and results",
+			src:  `func (s *S) M(name string, args ...int) (int, error) { return 0, nil }`,
+			before: `results := sandwich.NewChain(p.a.Around).Invoke(jp, func(args1 ...any) []any {
+if len(args1) == 2 {
+name, _ = args1[0].(string)
+args, _ = args1[1].([]int)
+}`,
+			after: `return []any{r0, r1}
+})
+if len(results) == 2 {
+r0, _ = results[0].(int)
+r1, _ = results[1].(error)
+}`,
+		},
+		{
+			name:   "nothing",
+			src:    `func (s *S) M() {}`,
+			before: `sandwich.NewChain(p.a.Around).Invoke(jp, func(args ...any) []any {`,
+			after: `return nil
+})`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, _ := parseAdvice(t, "type S struct{}\n\n"+tt.src+"\n")
+			names, _ := method.GetParams()
+			results, _ := method.GetResults()
+			scope := NewScope(append(append([]string{"p", "jp"}, names...), results...)...)
+			before, after := ChainStmt("jp", []string{"p.a.Around"}, method, scope)
+			assert.Equal(t, tt.before, strings.Join(before, "\n"))
+			assert.Equal(t, tt.after, strings.Join(after, "\n"))
+		})
+	}
+}
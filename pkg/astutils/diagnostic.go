@@ -0,0 +1,148 @@
+package astutils
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+type (
+	Severity       int
+	DiagnosticCode string
+)
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+const (
+	// CodeUnexportedProxy for @Proxy on an unexported struct
+	CodeUnexportedProxy = DiagnosticCode("unexported-proxy")
+	// CodeInvalidProxy for @Proxy options the struct does not support, like singleton= of a generic struct
+	CodeInvalidProxy = DiagnosticCode("invalid-proxy")
+	// CodeInvalidAspect for @Aspect options which are not supported, like an unknown mode=
+	CodeInvalidAspect = DiagnosticCode("invalid-aspect")
+	// CodeInvalidAdvice for advice which cannot be called in call mode, like around advice not returning []any
+	CodeInvalidAdvice = DiagnosticCode("invalid-advice")
+	// CodeInvalidReceiver for annotated method whose receiver type cannot be resolved
+	CodeInvalidReceiver = DiagnosticCode("invalid-receiver")
+	// CodeUnknownAspect for pointcut naming an aspect which does not exist
+	CodeUnknownAspect = DiagnosticCode("unknown-aspect")
+	// CodeInvalidPlaceholder for Joinpoint placeholder which cannot be resolved against the method
+	CodeInvalidPlaceholder = DiagnosticCode("invalid-placeholder")
+	// CodeInvalidTemplate for proxy template which cannot be executed
+	CodeInvalidTemplate = DiagnosticCode("invalid-template")
+	// CodeInvalidGenerated for generated source which cannot be formatted
+	CodeInvalidGenerated = DiagnosticCode("invalid-generated")
+	// CodeInvalidPackage for packages which cannot be listed, parsed or type checked
+	CodeInvalidPackage = DiagnosticCode("invalid-package")
+	// CodePlugin for errors returned by plugin hooks
+	CodePlugin = DiagnosticCode("plugin")
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// MarshalText encodes the severity as error or warning, e.g. in json.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic is a problem found while generating, reported as file:line:col: message.
+type Diagnostic struct {
+	Pos      token.Position `json:"pos"`
+	Severity Severity       `json:"severity"`
+	Code     DiagnosticCode `json:"code"`
+	Message  string         `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	msg := fmt.Sprintf("%s: %s [%s]", d.Severity, d.Message, d.Code)
+	if d.Pos.IsValid() || len(d.Pos.Filename) > 0 {
+		return d.Pos.String() + ": " + msg
+	}
+	return msg
+}
+
+// Diagnostics collects problems of a generator run, shared by all packages.
+type Diagnostics struct {
+	fset *token.FileSet
+	list []Diagnostic
+	seen map[Diagnostic]struct{}
+}
+
+func NewDiagnostics(fset *token.FileSet) *Diagnostics {
+	return &Diagnostics{
+		fset: fset,
+		seen: map[Diagnostic]struct{}{},
+	}
+}
+
+func (d *Diagnostics) Errorf(pos token.Pos, code DiagnosticCode, format string, args ...any) {
+	d.add(pos, SeverityError, code, fmt.Sprintf(format, args...))
+}
+
+func (d *Diagnostics) Warnf(pos token.Pos, code DiagnosticCode, format string, args ...any) {
+	d.add(pos, SeverityWarning, code, fmt.Sprintf(format, args...))
+}
+
+// ErrorAt reports an error at a position outside of the file set, like those of package load errors.
+func (d *Diagnostics) ErrorAt(pos token.Position, code DiagnosticCode, format string, args ...any) {
+	d.addAt(pos, SeverityError, code, fmt.Sprintf(format, args...))
+}
+
+func (d *Diagnostics) add(pos token.Pos, severity Severity, code DiagnosticCode, msg string) {
+	var position token.Position
+	if d.fset != nil && pos.IsValid() {
+		position = d.fset.Position(pos)
+	}
+	d.addAt(position, severity, code, msg)
+}
+
+func (d *Diagnostics) addAt(pos token.Position, severity Severity, code DiagnosticCode, msg string) {
+	diag := Diagnostic{
+		Pos:      pos,
+		Severity: severity,
+		Code:     code,
+		Message:  msg,
+	}
+	// the same declaration may be inspected more than once
+	if _, ok := d.seen[diag]; ok {
+		return
+	}
+	d.seen[diag] = struct{}{}
+	d.list = append(d.list, diag)
+}
+
+// List returns diagnostics sorted by position.
+func (d *Diagnostics) List() []Diagnostic {
+	sort.SliceStable(d.list, func(i, j int) bool {
+		a, b := d.list[i].Pos, d.list[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return d.list
+}
+
+func (d *Diagnostics) Len() int {
+	return len(d.list)
+}
+
+func (d *Diagnostics) HasErrors() bool {
+	for _, v := range d.list {
+		if v.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package astutils
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"unicode"
+)
+
+// AnnotationSyntax selects how annotations are written in doc comments.
+type AnnotationSyntax string
+
+const (
+	// SyntaxBoth accepts @Proxy("IFoo") comments and //sandwich:proxy IFoo directives
+	SyntaxBoth = AnnotationSyntax("both")
+	// SyntaxComment accepts @Proxy("IFoo") comments only
+	SyntaxComment = AnnotationSyntax("comment")
+	// SyntaxDirective accepts //sandwich:proxy IFoo directives only, hidden from godoc like //go: directives
+	SyntaxDirective = AnnotationSyntax("directive")
+
+	// DirectivePrefix of annotation directives, the name follows in lower camel case,
+	// //sandwich:proxy is @Proxy and //sandwich:transactional is @Transactional
+	DirectivePrefix = "sandwich:"
+)
+
+// Validate reports an unknown syntax, empty means both.
+func (s AnnotationSyntax) Validate() error {
+	switch s {
+	case "", SyntaxBoth, SyntaxComment, SyntaxDirective:
+		return nil
+	}
+	return fmt.Errorf("unknown annotation syntax %q, want both, comment or directive", s)
+}
+
+// annotationLines returns the annotation lines of c in the @Name(params) form,
+// directives are converted so that both forms produce the same annotations and keys.
+func (s AnnotationSyntax) annotationLines(c *ast.CommentGroup) []string {
+	if c == nil {
+		return nil
+	}
+	var lines []string
+	if s != SyntaxDirective {
+		// Text omits directives
+		lines = strings.Split(c.Text(), "\n")
+	}
+	if s != SyntaxComment {
+		for _, v := range c.List {
+			if line, ok := parseDirective(v.Text); ok {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// parseDirective converts //sandwich:proxy IFoo singleton=true to @Proxy(IFoo, singleton=true).
+func parseDirective(text string) (string, bool) {
+	text = strings.TrimPrefix(text, "//")
+	if !strings.HasPrefix(text, DirectivePrefix) {
+		return "", false
+	}
+	text = strings.TrimPrefix(text, DirectivePrefix)
+	name, args, _ := strings.Cut(text, " ")
+	if len(name) == 0 {
+		return "", false
+	}
+	line := "@" + title(name)
+	if fields := splitDirectiveArgs(args); len(fields) > 0 {
+		line += "(" + strings.Join(fields, ", ") + ")"
+	}
+	return line, true
+}
+
+// splitDirectiveArgs splits args by spaces outside double quotes.
+func splitDirectiveArgs(args string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+	)
+	for _, r := range args {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
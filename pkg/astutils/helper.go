@@ -1,22 +1,17 @@
 package astutils
 
 import (
-	"bytes"
 	"fmt"
 	"go/ast"
-	"go/printer"
+	"go/parser"
 	"go/token"
+	"go/types"
 	"html/template"
 	"regexp"
-	"strconv"
 	"strings"
-
-	"github.com/go-park/sandwich/pkg/aspect"
 )
 
 var (
-	regexParamTo    = regexp.MustCompile(`\.ParamTo\(([1-9][0-9]*)\)\.\((.*?)\)`)
-	regexResultTo   = regexp.MustCompile(`\.ResultTo\(([1-9][0-9]*)\)\.\((.*?)\)`)
 	regexAnnotation = regexp.MustCompile(`(@[A-Z][a-zA-Z]*)\(?.*\)?$`)
 )
 
@@ -32,13 +27,19 @@ func trimBrackets(s string) string {
 	})
 }
 
-func GetCommentParam(c *ast.CommentGroup, a Annotation) (ret map[AnnotationKey]string) {
+// GetCommentParam returns the params of annotation a in c, written in either syntax.
+func GetCommentParam(c *ast.CommentGroup, a Annotation) map[AnnotationKey]string {
+	return SyntaxBoth.GetCommentParam(c, a)
+}
+
+// GetCommentParam returns the params of annotation a in c, written in syntax s.
+func (s AnnotationSyntax) GetCommentParam(c *ast.CommentGroup, a Annotation) (ret map[AnnotationKey]string) {
 	if c == nil {
 		return
 	}
 	ret = make(map[AnnotationKey]string)
 	var defaultValues []string
-	for _, v := range strings.Split(c.Text(), "\n") {
+	for _, v := range s.annotationLines(c) {
 		if strings.HasPrefix(v, a.String()) {
 			str := strings.TrimPrefix(v, a.String())
 			str = strings.TrimSpace(str)
@@ -77,150 +78,18 @@ func GetImports(specs []*ast.ImportSpec) []*ProxyImport {
 	return imports
 }
 
-func replaceParamPlaceholder(advice aspect.Advice, method aspect.Method, stmt string) string {
-	var jpName string
-	var resultName string
-	if advice.Func().Type.Params != nil && len(advice.Func().Type.Params.List) > 0 {
-		param := advice.Func().Type.Params.List[0]
-		if len(param.Names) > 0 {
-			jpName = param.Names[0].Name
-		}
-	}
-	if advice.Func().Type.Results != nil && len(advice.Func().Type.Results.List) > 0 {
-		result := advice.Func().Type.Results.List[0]
-		if len(result.Names) > 0 {
-			resultName = result.Names[0].Name
-		}
-	}
-	// replace function name placeholder
-	funcStmt := jpName + ".FuncName()"
-	stmt = strings.ReplaceAll(stmt, funcStmt, fmt.Sprintf(`"%s"`, method.Name()))
-
-	// replace function args placeholder
-	paramNames, params := method.GetParams()
-	argsStmt := jpName + ".Params()"
-	args := fmt.Sprintf("[]interface{}{%s}", strings.Join(paramNames, ", "))
-	stmt = strings.ReplaceAll(stmt, argsStmt, args)
-
-	// replace function result placeholder
-	resultNames, results := method.GetResults()
-	argsStmt = jpName + ".Results()"
-	args = fmt.Sprintf("[]interface{}{%s}", strings.Join(resultNames, ", "))
-	stmt = strings.ReplaceAll(stmt, argsStmt, args)
-
-	// replace result assign placeholder
-	for i, v := range resultNames {
-		resultAssignStmt := fmt.Sprintf(resultName+"[%d]", i+1)
-		stmt = strings.ReplaceAll(stmt, resultAssignStmt, v)
-	}
-
-	// replace param assert placeholder
-	paramToStmt := jpName + ".ParamTo(%s).(%s)"
-	for _, sub := range regexParamTo.FindAllStringSubmatchIndex(stmt, -1) {
-		if len(sub) > 0 && strings.HasSuffix(stmt[0:sub[0]], jpName) {
-			index := stmt[sub[2]:sub[3]]
-			i, err := strconv.Atoi(index)
-			if err != nil {
-				panic(err)
-			}
-			typ := stmt[sub[4]:sub[5]]
-			param := params[i-1]
-			if strings.HasSuffix(param, typ) {
-				paramName := strings.Split(strings.Split(param, " ")[0], ",")[0]
-				raw := fmt.Sprintf(paramToStmt, index, typ)
-				stmt = strings.Replace(stmt, raw, paramName, 1)
-			}
-		}
-	}
-
-	// replace result assert placeholder
-	resultToStmt := jpName + ".ResultTo(%s).(%s)"
-	for _, sub := range regexResultTo.FindAllStringSubmatchIndex(stmt, -1) {
-		if len(sub) > 0 && strings.HasSuffix(stmt[0:sub[0]], jpName) {
-			index := stmt[sub[2]:sub[3]]
-			i, err := strconv.Atoi(index)
-			if err != nil {
-				panic(err)
-			}
-			typ := stmt[sub[4]:sub[5]]
-			result := results[i-1]
-			if strings.HasSuffix(result, typ) {
-				resultName := strings.Split(strings.Split(result, " ")[0], ",")[0]
-				raw := fmt.Sprintf(resultToStmt, index, typ)
-				stmt = strings.Replace(stmt, raw, resultName, 1)
-			}
-		}
-	}
-
-	// replace invalid assignment
-	if l := strings.Split(stmt, ":="); len(l) == 2 {
-		if strings.TrimSpace(l[0]) == strings.TrimSpace(l[1]) {
-			stmt = "-"
-		}
-	}
-
-	// replace proceed placeholder
-	proceedStmt := jpName + ".Proceed"
-	if strings.Contains(stmt, proceedStmt) {
-		stmt = "-proceed"
-	}
-
-	// return statement add prefix
-	if stmt == "return" || strings.HasPrefix(stmt, "return ") {
-		stmt = "-" + stmt
-	}
-	return stmt
-}
-
-func ParseAdviceStmt(advice aspect.Advice, method aspect.Method) []string {
-	var list []string
-	if advice == nil || advice.Func() == nil {
-		return list
-	}
-	for _, stmt := range advice.Func().Body.List {
-		var buf bytes.Buffer
-		_ = printer.Fprint(&buf, token.NewFileSet(), stmt)
-		s := strings.TrimSpace(buf.String())
-		for _, v := range strings.Split(s, "\n\t") {
-			for _, v := range strings.Split(v, "\n") {
-				s = replaceParamPlaceholder(advice, method, v)
-				list = append(list, s)
-			}
-		}
-	}
-	return list
-}
-
-func ParseAroundAdvice(advice aspect.Advice, method aspect.Method) ([]string, []string) {
-	var before, after []string
-	stmt := ParseAdviceStmt(advice, method)
-	stmtLen := len(stmt)
-	proceedIndex := len(stmt) + 1
-	for i, v := range stmt {
-		if v == "-proceed" {
-			proceedIndex = i + 1
-		}
-		if strings.HasPrefix(v, "-return") {
-			stmt[i] = strings.TrimPrefix(v, "-")
-		}
-	}
-	lastStmt := stmt[stmtLen-1]
-	if lastStmt == "return" || strings.HasPrefix(lastStmt, "return ") {
-		stmt[stmtLen-1] = "-" + lastStmt
-	}
-	before = stmt[:proceedIndex:proceedIndex]
-	if proceedIndex < len(stmt)+1 {
-		after = stmt[proceedIndex:]
-	}
-	return before, after
+// ParseAnnotation returns the annotations of c, written in either syntax.
+func ParseAnnotation(c *ast.CommentGroup) []Annotation {
+	return SyntaxBoth.ParseAnnotation(c)
 }
 
-func parseAnnotation(c *ast.CommentGroup) []Annotation {
+// ParseAnnotation returns the annotations of c written in syntax s.
+func (s AnnotationSyntax) ParseAnnotation(c *ast.CommentGroup) []Annotation {
 	if c == nil {
 		return nil
 	}
 	var result []Annotation
-	for _, v := range strings.Split(c.Text(), "\n") {
+	for _, v := range s.annotationLines(c) {
 		if ss := regexAnnotation.FindStringSubmatch(v); len(ss) > 1 {
 			anno := Annotation(ss[1])
 			result = append(result, anno)
@@ -229,7 +98,22 @@ func parseAnnotation(c *ast.CommentGroup) []Annotation {
 	return result
 }
 
-func validCustomAnnotation(name string) (Annotation, bool) {
+// HasAnnotation reports whether any comment of the go source declares an annotation.
+func HasAnnotation(src []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ParseComments)
+	if err != nil {
+		// keep unparsable files relevant, they are likely being edited
+		return true
+	}
+	for _, c := range f.Comments {
+		if len(ParseAnnotation(c)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidCustomAnnotation(name string) (Annotation, bool) {
 	full := "@" + name
 	if regexAnnotation.MatchString(full) {
 		anno := Annotation(full)
@@ -246,6 +130,8 @@ func getPkgAndName(expr ast.Expr) (pkg string, name string) {
 		expr = star.X
 		hasStar = true
 	}
+	// instantiated generic type, Repo[User]
+	expr, args := splitTypeArgs(expr)
 	if sel, ok := expr.(*ast.SelectorExpr); ok {
 		pkg = sel.X.(*ast.Ident).Name
 		name = sel.Sel.Name
@@ -254,21 +140,164 @@ func getPkgAndName(expr ast.Expr) (pkg string, name string) {
 		pkg = ""
 		name = i.Name
 	}
+	if len(name) > 0 && len(args) > 0 {
+		name += "[" + strings.Join(args, ", ") + "]"
+	}
 	if hasStar {
 		name = "*" + name
 	}
 	return pkg, name
 }
 
+// splitTypeArgs returns the generic type of an instantiation and its type arguments in source form.
+func splitTypeArgs(expr ast.Expr) (ast.Expr, []string) {
+	var indices []ast.Expr
+	switch t := expr.(type) {
+	case *ast.IndexExpr:
+		expr, indices = t.X, []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		expr, indices = t.X, t.Indices
+	}
+	var args []string
+	for _, v := range indices {
+		args = append(args, types.ExprString(v))
+	}
+	return expr, args
+}
+
+// TrimTypeArgs removes the type arguments of a type name, Repo[User] is Repo.
+func TrimTypeArgs(name string) string {
+	if i := strings.Index(name, "["); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// TypeParamNames returns the names of type parameters as type arguments, [K, V], empty if there are none.
+func TypeParamNames(params *ast.FieldList) string {
+	if params == nil || len(params.List) == 0 {
+		return ""
+	}
+	var names []string
+	for _, f := range params.List {
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// TypeParamsDecl returns type parameters in source form, [K comparable, V any], empty if there are none.
+func TypeParamsDecl(params *ast.FieldList) string {
+	if params == nil || len(params.List) == 0 {
+		return ""
+	}
+	var list []string
+	for _, f := range params.List {
+		var names []string
+		for _, n := range f.Names {
+			names = append(names, n.Name)
+		}
+		list = append(list, strings.Join(names, ", ")+" "+types.ExprString(f.Type))
+	}
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// ReceiverTypeArgs returns the type parameter names of a method receiver of a generic type,
+// (r *Repo[E]) gives [E], empty for other receivers.
+func ReceiverTypeArgs(decl *ast.FuncDecl) string {
+	if decl == nil || decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if _, args := splitTypeArgs(expr); len(args) > 0 {
+		return "[" + strings.Join(args, ", ") + "]"
+	}
+	return ""
+}
+
 func IsTypeIdent(expr ast.Expr) (*ast.Ident, bool) {
 	if star, ok := expr.(*ast.StarExpr); ok {
 		expr = star.X
 	}
+	// receiver of a generic type, Repo[T]
+	expr, _ = splitTypeArgs(expr)
 	if sel, ok := expr.(*ast.SelectorExpr); ok {
-		expr = sel.X.(*ast.Ident)
+		expr = sel.X
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok || ident.Obj == nil {
+		return nil, false
 	}
-	if ident, ok := expr.(*ast.Ident); ok {
-		return ident.Obj.Decl.(*ast.TypeSpec).Name, true
+	if spec, ok := ident.Obj.Decl.(*ast.TypeSpec); ok {
+		return spec.Name, true
 	}
 	return nil, false
 }
+
+// GetDelegateMethods returns pass-through proxy methods for every exported
+// method of *obj which is not listed in advised, so that the proxy keeps
+// satisfying the abstract type of its parent.
+func GetDelegateMethods(obj types.Object, advised map[string]struct{}) ([]*ProxyMethod, []*ProxyImport) {
+	var methods []*ProxyMethod
+	if obj == nil {
+		return methods, nil
+	}
+	r := newImportRecorder(obj.Pkg(), nil)
+	mset := types.NewMethodSet(types.NewPointer(obj.Type()))
+	for i := 0; i < mset.Len(); i++ {
+		fn, ok := mset.At(i).Obj().(*types.Func)
+		if !ok || !fn.Exported() {
+			continue
+		}
+		if _, ok := advised[fn.Name()]; ok {
+			continue
+		}
+		sig := fn.Type().(*types.Signature)
+		var paramNames, params, args, resultNames, results []string
+		for j := 0; j < sig.Params().Len(); j++ {
+			v := sig.Params().At(j)
+			name := v.Name()
+			if len(name) == 0 || name == "_" {
+				name = fmt.Sprintf("a%d", j)
+			}
+			variadic := sig.Variadic() && j == sig.Params().Len()-1
+			arg := name
+			if variadic {
+				arg += "..."
+			}
+			paramNames = append(paramNames, name)
+			params = append(params, name+" "+r.typeString(v, variadic))
+			args = append(args, arg)
+		}
+		for j := 0; j < sig.Results().Len(); j++ {
+			name := fmt.Sprintf("r%d", j)
+			resultNames = append(resultNames, name)
+			results = append(results, name+" "+r.typeString(sig.Results().At(j), false))
+		}
+		var typeArgs []string
+		for j := 0; j < sig.RecvTypeParams().Len(); j++ {
+			typeArgs = append(typeArgs, sig.RecvTypeParams().At(j).Obj().Name())
+		}
+		proceedStmt := fmt.Sprintf("p.parent.%s(%s)", fn.Name(), strings.Join(args, ", "))
+		if len(resultNames) > 0 {
+			proceedStmt = fmt.Sprintf("%s = %s", strings.Join(resultNames, ", "), proceedStmt)
+		}
+		m := &ProxyMethod{
+			Name:        fn.Name(),
+			Params:      template.HTML(strings.Join(params, ", ")),
+			ParamNames:  strings.Join(paramNames, ", "),
+			Results:     template.HTML(strings.Join(results, ", ")),
+			ResultNames: strings.Join(resultNames, ", "),
+			After:       []any{template.HTML(proceedStmt)},
+		}
+		if len(typeArgs) > 0 {
+			m.TypeArgs = template.HTML("[" + strings.Join(typeArgs, ", ") + "]")
+		}
+		methods = append(methods, m)
+	}
+	return methods, GetImports(r.specs)
+}
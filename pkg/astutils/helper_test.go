@@ -0,0 +1,74 @@
+package astutils
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimTypeArgs(t *testing.T) {
+	for name, want := range map[string]string{
+		"Repo":                               "Repo",
+		"example.com/m.IRepo[User]":          "example.com/m.IRepo",
+		"example.com/m/store.*Store[T]":      "example.com/m/store.*Store",
+		"example.com/m.Cache[string, []int]": "example.com/m.Cache",
+		"":                                   "",
+	} {
+		assert.Equal(t, want, TrimTypeArgs(name), name)
+	}
+}
+
+func TestTypeParams(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", `package p
+
+type Plain struct{}
+
+type Repo[T any] struct{}
+
+type Cache[K comparable, V any] struct{}
+
+type Pair[A, B fmt.Stringer] struct{}
+
+func (r *Repo[T]) Get() {}
+
+func (c Cache[K, V]) Set() {}
+
+func (p *Plain) Do() {}
+`, 0)
+	assert.NoError(t, err)
+	tests := []struct {
+		name         string
+		names, decls string
+		receiver     string
+	}{
+		{name: "Plain", receiver: "Do"},
+		{name: "Repo", names: "[T]", decls: "[T any]", receiver: "Get"},
+		{name: "Cache", names: "[K, V]", decls: "[K comparable, V any]", receiver: "Set"},
+		{name: "Pair", names: "[A, B]", decls: "[A, B fmt.Stringer]"},
+	}
+	for _, tt := range tests {
+		spec := file.Scope.Lookup(tt.name).Decl.(*ast.TypeSpec)
+		assert.Equal(t, tt.names, TypeParamNames(spec.TypeParams), tt.name)
+		assert.Equal(t, tt.decls, TypeParamsDecl(spec.TypeParams), tt.name)
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		for _, tt := range tests {
+			if tt.receiver != fn.Name.Name {
+				continue
+			}
+			assert.Equal(t, tt.names, ReceiverTypeArgs(fn), fn.Name.Name)
+			ident, ok := IsTypeIdent(fn.Recv.List[0].Type)
+			if assert.True(t, ok, fn.Name.Name) {
+				assert.Equal(t, tt.name, ident.Name)
+			}
+		}
+	}
+	assert.Empty(t, ReceiverTypeArgs(nil))
+}
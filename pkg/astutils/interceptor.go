@@ -1,7 +1,10 @@
 package astutils
 
 import (
+	"fmt"
 	"go/ast"
+	"sort"
+	"strings"
 
 	"github.com/go-park/sandwich/pkg/aspect"
 	"github.com/go-park/sandwich/pkg/tools/collections"
@@ -10,15 +13,18 @@ import (
 type (
 	ProxyInterceptor func([]Annotation, aspect.Proxy, *ast.StructType) []aspect.ProxyOption
 	FieldInterceptor func([]Annotation, aspect.Field, *ast.Field) []aspect.FieldOption
+	// Extension is a named set of interceptors which can be enabled by project config
+	Extension struct {
+		Name              string
+		ProxyInterceptors []ProxyInterceptor
+		FieldInterceptors []FieldInterceptor
+	}
 )
 
-func init() {
-	proxyInterceptors = append(proxyInterceptors, proxyParamProcess)
-}
-
 var (
 	proxyInterceptors []ProxyInterceptor
 	fieldInterceptors []FieldInterceptor
+	extensions        = map[string]Extension{}
 )
 
 func RegisterProxyInterceptors(opts ...ProxyInterceptor) {
@@ -29,25 +35,73 @@ func RegisterFieldInterceptors(opts ...FieldInterceptor) {
 	fieldInterceptors = append(fieldInterceptors, opts...)
 }
 
-func proxyParamProcess(ann []Annotation, pro aspect.Proxy, t *ast.StructType) (result []aspect.ProxyOption) {
-	params := GetCommentParam(pro.Docs(), CommentProxy)
+func RegisterExtension(ext Extension) {
+	extensions[ext.Name] = ext
+}
+
+// LookupExtensions returns the registered extensions of names sorted by name, all of them if names is empty.
+func LookupExtensions(names ...string) ([]Extension, error) {
+	var list []Extension
+	if len(names) == 0 {
+		for _, ext := range extensions {
+			list = append(list, ext)
+		}
+	}
+	for _, name := range names {
+		ext, ok := extensions[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extension %q", name)
+		}
+		list = append(list, ext)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func activeProxyInterceptors(exts []Extension) []ProxyInterceptor {
+	list := append([]ProxyInterceptor{}, proxyInterceptors...)
+	for _, ext := range exts {
+		list = append(list, ext.ProxyInterceptors...)
+	}
+	return list
+}
+
+func activeFieldInterceptors(exts []Extension) []FieldInterceptor {
+	list := append([]FieldInterceptor{}, fieldInterceptors...)
+	for _, ext := range exts {
+		list = append(list, ext.FieldInterceptors...)
+	}
+	return list
+}
+
+// proxyParams applies the params of @Proxy and its struct level pointcuts, before interceptors.
+func proxyParams(syntax AnnotationSyntax, ann []Annotation, pro aspect.Proxy) (result []aspect.ProxyOption) {
+	params := syntax.GetCommentParam(pro.Docs(), CommentProxy)
 	// proxy object
 	abstract := params[CommentKeyAbstract]
 	if v, ok := params[CommentKeyDefault]; ok {
 		abstract = v
 	}
 	// factory method suffix
-	suffix := DefaultProxySuffix
+	suffix := pro.Suffix()
+	if len(suffix) == 0 {
+		suffix = DefaultProxySuffix
+	}
 	if v, ok := params[CommentKeySuffix]; ok {
 		suffix = v
 	}
 	// factory method option
 	option := params[CommentKeyOption]
 	// is singleton
-	var singleton bool
-	s := params[CommentKeySingleton]
-	if s == "true" {
-		singleton = true
+	singleton := pro.IsSingleton()
+	if s, ok := params[CommentKeySingleton]; ok {
+		singleton = s == "true"
+	}
+
+	// custom template
+	tpl := pro.Template()
+	if v, ok := params[CommentKeyTemplate]; ok {
+		tpl = v
 	}
 
 	result = append(result,
@@ -55,12 +109,17 @@ func proxyParamProcess(ann []Annotation, pro aspect.Proxy, t *ast.StructType) (r
 		aspect.WithProxySuffix(suffix),
 		aspect.WithProxyOption(option),
 		aspect.WithProxyMode(singleton),
+		aspect.WithProxyTemplate(tpl),
 	)
 	var pos []aspect.Pointcut
 	if collections.Contains(ann, CommentPointcut) {
-		params := GetCommentParam(pro.Docs(), CommentPointcut)
+		params := syntax.GetCommentParam(pro.Docs(), CommentPointcut)
 		for _, v := range params {
-			pos = append(pos, aspect.NewPointcut(aspect.WithPointcutName(v)))
+			for _, v := range strings.Split(v, ",") {
+				pos = append(pos, aspect.NewPointcut(
+					aspect.WithPointcutName(v),
+					aspect.WithPointcutPos(pro.Docs().Pos())))
+			}
 		}
 	}
 	result = append(result, aspect.WithProxyPointcuts(pos...))
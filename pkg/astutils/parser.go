@@ -5,7 +5,6 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
-	"log"
 	"strings"
 
 	"github.com/go-park/sandwich/pkg/aspect"
@@ -20,21 +19,44 @@ type File struct {
 	Imports map[string]string
 }
 
+// name returns the path of the file, empty if it is unknown.
+func (f *File) name() string {
+	if f.File == nil || f.Pkg == nil || f.Pkg.AstPkg == nil || f.Pkg.AstPkg.Fset == nil {
+		return ""
+	}
+	return f.Pkg.AstPkg.Fset.Position(f.File.Package).Filename
+}
+
 type Package struct {
 	Path              string
 	Pwd               string
+	Dir               string // working directory packages are loaded from
 	Name              string
 	AstPkg            *packages.Package
 	Files             []*File
 	Defs              map[*ast.Ident]types.Object
 	OutputFiles       map[string][]byte
 	FileBuf           map[string]bytes.Buffer
+	Unchanged         map[string]struct{} // FileBuf keys restored from cache
 	AspectCache       map[string]aspect.Aspect
 	AspectAlias       map[string]string
 	AspectCustoms     map[Annotation]string
 	ProxyCache        map[*ast.Ident]aspect.Proxy
 	DelayAspectLoader map[Annotation][]func()
 	ComponentCache    map[string]aspect.Component
+	Diagnostics       *Diagnostics
+	ProxySuffix       string      // default suffix when @Proxy omits suffix=
+	Singleton         bool        // default mode when @Proxy omits singleton=
+	Extensions        []Extension // in use, all registered extensions if nil
+	Syntax            AnnotationSyntax
+}
+
+func (p *Package) extensions() []Extension {
+	if p.Extensions == nil {
+		all, _ := LookupExtensions()
+		return all
+	}
+	return p.Extensions
 }
 
 func (p *Package) ImportPath() string {
@@ -56,7 +78,7 @@ func (f *File) InspectGenDecl(node ast.Node) bool {
 }
 
 func (f *File) parseField(fi *ast.Field) (list []aspect.Field) {
-	fieldAllPosAnno := parseAnnotation(fi.Doc)
+	fieldAllPosAnno := f.Pkg.Syntax.ParseAnnotation(fi.Doc)
 
 	tPkg, tName := getPkgAndName(fi.Type)
 	if len(tName) == 0 {
@@ -72,6 +94,7 @@ func (f *File) parseField(fi *ast.Field) (list []aspect.Field) {
 	if !collections.Contains(fieldAllPosAnno, CommentInject) {
 		inject = ""
 	}
+	interceptors := activeFieldInterceptors(f.Pkg.extensions())
 	for _, name := range fi.Names {
 		f := aspect.NewField(
 			aspect.WithFieldName(name.Name),
@@ -80,7 +103,7 @@ func (f *File) parseField(fi *ast.Field) (list []aspect.Field) {
 			aspect.WithFieldDoc(fi.Doc),
 		)
 		tf := f.Clone()
-		for _, i := range fieldInterceptors {
+		for _, i := range interceptors {
 			for _, fn := range i(fieldAllPosAnno, f, fi) {
 				fn(&tf)
 			}
@@ -111,8 +134,10 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 				name := pathList[len(pathList)-1]
 				if imp.Name != nil {
 					name = imp.Name.Name
+				} else if ipkg, ok := f.Pkg.AstPkg.Imports[path]; ok && len(ipkg.Name) > 0 {
+					name = ipkg.Name
 				} else {
-					pList, _ := packages.Load(&packages.Config{Mode: packages.NeedName}, path)
+					pList, _ := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: f.Pkg.Dir}, path)
 					if len(pList) > 0 {
 						name = pList[0].Name
 					}
@@ -130,7 +155,7 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 		return true
 	}
 	ident := spec.Name
-	allPosAnno := parseAnnotation(decl.Doc)
+	allPosAnno := f.Pkg.Syntax.ParseAnnotation(decl.Doc)
 	if collections.Contains(allPosAnno, CommentProxy) {
 		structT, ok := spec.Type.(*ast.StructType)
 		if !ok {
@@ -142,6 +167,8 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 				aspect.WithProxyPkg(f.Pkg.Path, f.Pkg.Name),
 				aspect.WithProxyName(ident.String()),
 				aspect.WithProxyImports(f.File.Imports),
+				aspect.WithProxySuffix(f.Pkg.ProxySuffix),
+				aspect.WithProxyMode(f.Pkg.Singleton),
 				aspect.WithProxyDoc(decl.Doc))
 		}
 		if structT.Fields != nil {
@@ -154,7 +181,11 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 		}
 		// intercept
 		cp := p.Clone()
-		for _, i := range proxyInterceptors {
+		aspect.WithProxyTypeParams(spec.TypeParams)(&cp)
+		for _, fn := range proxyParams(f.Pkg.Syntax, allPosAnno, p) {
+			fn(&cp)
+		}
+		for _, i := range activeProxyInterceptors(f.Pkg.extensions()) {
 			for _, fn := range i(allPosAnno, p, structT) {
 				fn(&cp)
 			}
@@ -164,7 +195,9 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 		comp := aspect.NewComponent(
 			aspect.WithComponentFactory(pkg.Path, "New"+p.Name()+p.Suffix()),
 			aspect.WithComponentPkg(pkg.Path, pkg.Name),
-			aspect.WithComponentName(pkg.Path+"."+p.Abstract()),
+			aspect.WithComponentName(pkg.Path+"."+TrimTypeArgs(p.Abstract())),
+			aspect.WithComponentFile(f.name()),
+			aspect.WithComponentGeneric(spec.TypeParams != nil),
 		)
 		f.Pkg.ComponentCache[comp.Name()] = comp
 	}
@@ -172,13 +205,13 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 	// aspect cache
 	if collections.Contains(allPosAnno, CommentAspect) {
 		name := ident.String()
-		params := GetCommentParam(decl.Doc, CommentAspect)
+		params := f.Pkg.Syntax.GetCommentParam(decl.Doc, CommentAspect)
 		fullName := f.Pkg.Name + "." + name
 		if alias, ok := params[CommentKeyDefault]; ok {
 			f.Pkg.AspectAlias[alias] = fullName
 		}
 		if custom, ok := params[CommentKeyCustom]; ok {
-			if anno, ok := validCustomAnnotation(custom); ok {
+			if anno, ok := ValidCustomAnnotation(custom); ok {
 				f.Pkg.AspectCustoms[anno] = fullName
 			}
 		}
@@ -186,9 +219,19 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 		if !ok {
 			a = aspect.NewAspect(
 				aspect.WithAspectName(name),
+				aspect.WithAspectPkg(f.Pkg.Path, f.Pkg.Name),
 				aspect.WithAspectImports(f.File.Imports),
 			)
 		}
+		if mode, ok := params[CommentKeyMode]; ok {
+			switch m := aspect.AdviceMode(mode); m {
+			case aspect.ModeInline, aspect.ModeCall:
+				a.SetMode(m)
+			default:
+				f.Pkg.Diagnostics.Errorf(ident.Pos(), CodeInvalidAspect,
+					"unknown mode %q of aspect %s, want inline or call", mode, name)
+			}
+		}
 		f.Pkg.AspectCache[fullName] = a
 	}
 	return false
@@ -196,7 +239,7 @@ func (f *File) genDecl(decl *ast.GenDecl, pkg *Package) bool {
 
 // funcDecl processes one function declaration clause.
 func (f *File) funcDecl(decl *ast.FuncDecl, pkg *Package) bool {
-	allPosAnno := parseAnnotation(decl.Doc)
+	allPosAnno := f.Pkg.Syntax.ParseAnnotation(decl.Doc)
 	if len(allPosAnno) == 0 {
 		return false
 	}
@@ -217,35 +260,50 @@ func (f *File) funcDecl(decl *ast.FuncDecl, pkg *Package) bool {
 	var ident *ast.Ident
 	ident, ok := IsTypeIdent(recv.Type)
 	if !ok {
-		log.Panic("invalid component type")
+		f.Pkg.Diagnostics.Errorf(recv.Type.Pos(), CodeInvalidReceiver,
+			"cannot resolve receiver type of %s", decl.Name.Name)
+		return false
 	}
 	// Pointcut
 	if collections.Contains(allPosAnno, CommentPointcut) || matchCustomAnno {
 		method := aspect.NewMethod(aspect.WithMethodDecl(decl))
+		// render the signature from type information, the declaration is the fallback
+		if info := f.Pkg.AstPkg.TypesInfo; info != nil {
+			if fn, ok := info.Defs[decl.Name].(*types.Func); ok {
+				method = aspect.NewMethod(aspect.WithMethodDecl(decl),
+					aspect.WithMethodSignature(MethodSignature(fn, f.Imports)))
+			}
+		}
 		p, ok := f.Pkg.ProxyCache[ident]
 		if !ok {
 			// half object cache
 			p = aspect.NewProxy(
 				aspect.WithProxyPkg(f.Pkg.Path, f.Pkg.Name),
 				aspect.WithProxyName(ident.String()),
+				aspect.WithProxySuffix(f.Pkg.ProxySuffix),
+				aspect.WithProxyMode(f.Pkg.Singleton),
 				aspect.WithProxyImports(f.File.Imports))
 		}
-		params := GetCommentParam(decl.Doc, CommentPointcut)
+		params := f.Pkg.Syntax.GetCommentParam(decl.Doc, CommentPointcut)
 		for _, v := range params {
 			for _, v := range strings.Split(v, ",") {
-				method.SetPointcuts(aspect.NewPointcut(aspect.WithPointcutName(v)))
+				method.SetPointcuts(aspect.NewPointcut(
+					aspect.WithPointcutName(v),
+					aspect.WithPointcutPos(decl.Doc.Pos())))
 			}
 		}
 		// support custom aspect annotation
 		for _, v := range allPosAnno {
-			method.SetPointcuts(aspect.NewPointcut(aspect.WithPointcutName(v.String())))
+			method.SetPointcuts(aspect.NewPointcut(
+				aspect.WithPointcutName(v.String()),
+				aspect.WithPointcutPos(decl.Doc.Pos())))
 		}
 		p.SetMethods(method)
 		f.Pkg.ProxyCache[ident] = p
 	}
 	// Advice
 	if collections.ContainsAny(allPosAnno, AdviceAnnotationList()...) {
-		advice := aspect.NewAdvice(aspect.WithAdviceDecl(decl))
+		advice := aspect.NewAdvice(aspect.WithAdviceDecl(decl), aspect.WithAdviceTypesInfo(f.Pkg.AstPkg.TypesInfo))
 		aspectName := ident.String()
 		fullName := f.Pkg.Name + "." + aspectName
 		a, ok := f.Pkg.AspectCache[fullName]
@@ -253,6 +311,7 @@ func (f *File) funcDecl(decl *ast.FuncDecl, pkg *Package) bool {
 			// half object cache
 			a = aspect.NewAspect(
 				aspect.WithAspectName(aspectName),
+				aspect.WithAspectPkg(f.Pkg.Path, f.Pkg.Name),
 				aspect.WithAspectImports(f.File.Imports),
 			)
 			f.Pkg.AspectCache[fullName] = a
@@ -291,10 +350,17 @@ func (f *File) componentDecl(decl *ast.FuncDecl, pkg *Package) bool {
 		compPkg = pkg.ImportPath()
 		compPkgName = pkg.Name
 	}
+	// a generic factory provides every instantiation of its result type
+	generic := decl.Type.TypeParams != nil
+	if generic {
+		compName = TrimTypeArgs(compName)
+	}
 	comp := aspect.NewComponent(
 		aspect.WithComponentFactory(pkg.Path, decl.Name.Name),
 		aspect.WithComponentPkg(compPkg, compPkgName),
 		aspect.WithComponentName(compPkg+"."+compName),
+		aspect.WithComponentFile(f.name()),
+		aspect.WithComponentGeneric(generic),
 	)
 	f.Pkg.ComponentCache[comp.Name()] = comp
 	return true
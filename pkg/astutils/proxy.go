@@ -1,27 +1,56 @@
 package astutils
 
-import "html/template"
+import (
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
+// ProxyDataVersion is the version of ProxyData, the data model of proxy templates.
+// It is increased whenever a field is renamed, removed or changes its meaning.
+const ProxyDataVersion = 2
+
+// ProxyData is executed by proxy templates, one per proxied struct.
 type ProxyData struct {
-	Package         string
+	// Version is ProxyDataVersion
+	Version int
+	// Package is the name of the package of the proxied struct, PkgPath its import path
+	Package string
+	PkgPath string
+	// Imports are needed by advice and method signatures, unused ones are removed on format
 	Imports         []*ProxyImport
 	ProxyStructName string
-	Option          string
-	Methods         []*ProxyMethod
-	AbstractName    string
-	ParentName      string
-	InjectFields    []*ProxyInjectField
-	Singleton       bool
+	// Option is the type of factory options, empty without option=
+	Option  string
+	Methods []*ProxyMethod
+	// AbstractName is the type returned by the factory
+	AbstractName string
+	// ParentName is the name of the proxied struct
+	ParentName   string
+	InjectFields []*ProxyInjectField
+	// Aspects are fields of the proxy holding the instances of aspects whose advice is called
+	Aspects   []*ProxyAspectField
+	Singleton bool
+	// TypeParams of a generic struct with constraints, [K comparable, V any],
+	// TypeArgs their names, [K, V], both empty otherwise
+	TypeParams template.HTML
+	TypeArgs   template.HTML
 }
 
+// ProxyMethod is a method of the proxy, advised or delegating to the parent.
 type ProxyMethod struct {
 	Name        string
-	Params      string
-	ParamNames  string
-	Results     string
-	ResultNames string
-	Before      []any
-	After       []any
+	Params      template.HTML // declaration, a int, b string
+	ParamNames  string        // a, b
+	Results     template.HTML // declaration with names, r0 int, r1 error
+	ResultNames string        // r0, r1
+	// TypeArgs are the type parameter names of the receiver of a generic struct, [E],
+	// which Params and Results refer to
+	TypeArgs template.HTML
+	// Before is the advice inlined before the call of the parent, After the call followed by the rest
+	Before []any
+	After  []any
 }
 
 type ProxyImport struct {
@@ -34,8 +63,16 @@ type ProxyInjectField struct {
 	Val template.HTML
 }
 
+// ProxyAspectField is an aspect of call mode, Type its type and Val the instance, by its
+// @Component factory or a new zero value.
+type ProxyAspectField struct {
+	Var  template.HTML
+	Type template.HTML
+	Val  template.HTML
+}
+
 const proxyTpl = `
-// Code generated by sandwich. DO NOT EDIT.
+` + GeneratedHeader + `
 
 package {{.Package}}
 
@@ -45,15 +82,18 @@ import (
 	{{- end}}
 )
 
-type {{ .ProxyStructName }} struct {
-	parent {{ .ParentName }}
+type {{ .ProxyStructName }}{{ .TypeParams }} struct {
+	parent *{{ .ParentName }}{{ .TypeArgs }}
+	{{- range $i, $a := .Aspects }}
+	{{ $a.Var }} {{ $a.Type }}
+	{{- end }}
 }
 
 
 {{ if ne $.Singleton true}}
 //@Component
-func New{{ .ProxyStructName }}({{ $optLen := len .Option }} {{ if ne $optLen 0 }} opts ...{{ .Option }}	{{ end }}) {{ .AbstractName }} {
-	pa := &{{ .ParentName }}{
+func New{{ .ProxyStructName }}{{ .TypeParams }}({{ $optLen := len .Option }} {{ if ne $optLen 0 }} opts ...{{ .Option }}	{{ end }}) {{ .AbstractName }} {
+	pa := &{{ .ParentName }}{{ .TypeArgs }}{
 	{{- range $i, $a := .InjectFields }}
 	{{ $a.Var }}: {{ $a.Val }},
 	{{- end }}
@@ -63,29 +103,34 @@ func New{{ .ProxyStructName }}({{ $optLen := len .Option }} {{ if ne $optLen 0 }
 		fn(pa)
 	}
 	{{ end }}
-	return pa
+	return &{{ .ProxyStructName }}{{ .TypeArgs }}{parent: pa{{ range $i, $a := .Aspects }}, {{ $a.Var }}: {{ $a.Val }}{{ end }}}
 }
 {{ else }}
 var (
-	_{{ .AbstractName }}Inst {{ .AbstractName }} 
-	_{{ .AbstractName }}Once sync.Once
+	_{{ .ProxyStructName }}Inst {{ .AbstractName }}
+	_{{ .ProxyStructName }}Once sync.Once
 )
 
 //@Component
 func New{{ .ProxyStructName }}() {{ .AbstractName }} {
-	_{{ .AbstractName }}Once.Do(func(){
-		_{{ .AbstractName }}Inst = &{{ .ParentName }}{
+	_{{ .ProxyStructName }}Once.Do(func(){
+		_{{ .ProxyStructName }}Inst = &{{ .ProxyStructName }}{
+			parent: &{{ .ParentName }}{
 			{{- range $i, $a := .InjectFields }}
 			{{ $a.Var }}: {{ $a.Val }},
 			{{- end }}
-			}
+			},
+			{{- range $i, $a := .Aspects }}
+			{{ $a.Var }}: {{ $a.Val }},
+			{{- end }}
+		}
 	})
-	return _{{ .AbstractName }}Inst
+	return _{{ .ProxyStructName }}Inst
 }
 {{ end }}
 
 {{ range .Methods }}
-func (p *{{$.ProxyStructName}}) {{ .Name }} ({{ .Params }}) ({{ .Results }}) {
+func (p *{{$.ProxyStructName}}{{ .TypeArgs }}) {{ .Name }} ({{ .Params }}) ({{ .Results }}) {
 	{{- range $i, $s := .Before }}
 	{{ $s }}
 	{{- end }}
@@ -101,6 +146,40 @@ func GetProxyTpl() string {
 	return proxyTpl
 }
 
+// TemplateFuncs are available in proxy templates besides the builtin functions.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"header":     func() template.HTML { return GeneratedHeader },
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"title":      title,
+		"join":       strings.Join,
+		"replace":    strings.ReplaceAll,
+		"hasPrefix":  strings.HasPrefix,
+		"hasSuffix":  strings.HasSuffix,
+		"trimPrefix": strings.TrimPrefix,
+		"trimSuffix": strings.TrimSuffix,
+		"quote":      strconv.Quote,
+		// raw disables escaping, like template.HTML values of ProxyMethod
+		"raw": func(s string) template.HTML { return template.HTML(s) },
+	}
+}
+
+// ParseProxyTemplate parses a proxy template with TemplateFuncs.
+func ParseProxyTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(TemplateFuncs()).Parse(text)
+}
+
+func title(s string) string {
+	runes := []rune(s)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToUpper(runes[0])
+	}
+	return string(runes)
+}
+
 const (
 	DefaultProxySuffix = "Proxy"
+	// GeneratedHeader marks files written by the generator
+	GeneratedHeader = "// Code generated by sandwich. DO NOT EDIT."
 )
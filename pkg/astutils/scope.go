@@ -0,0 +1,182 @@
+package astutils
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+// Scope holds the names in use by a proxy method while advice is inlined into it,
+// locals of advice colliding with any of them are renamed.
+type Scope struct {
+	used map[string]struct{}
+}
+
+// NewScope returns a scope in which names, like the receiver, params and results, are in use.
+func NewScope(names ...string) *Scope {
+	s := &Scope{used: map[string]struct{}{}}
+	s.Reserve(names...)
+	return s
+}
+
+// Reserve marks names as in use without renaming them.
+func (s *Scope) Reserve(names ...string) {
+	for _, v := range names {
+		s.used[v] = struct{}{}
+	}
+}
+
+// Declare returns name, or name followed by the first free number if it is in use, and reserves it.
+func (s *Scope) Declare(name string) string {
+	if name == "_" {
+		return name
+	}
+	v := name
+	for i := 1; ; i++ {
+		if _, ok := s.used[v]; !ok {
+			break
+		}
+		v = name + strconv.Itoa(i)
+	}
+	s.used[v] = struct{}{}
+	return v
+}
+
+// ReserveAdvice reserves the names advice refers to without declaring them, like packages,
+// package level declarations and fields, so that no local of other advice shadows them.
+func (s *Scope) ReserveAdvice(advice aspect.Advice) {
+	body := adviceBody(advice)
+	if body == nil {
+		return
+	}
+	l := newLocals(advice)
+	ast.Inspect(body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && l.of(ident) == nil {
+			s.used[ident.Name] = struct{}{}
+		}
+		return true
+	})
+}
+
+// rename renames the locals declared in the body of advice which are in use by the scope in body,
+// a copy of it whose nodes are mapped to those of the advice by origins.
+func (s *Scope) rename(advice aspect.Advice, body *ast.BlockStmt, origins map[ast.Node]ast.Node) {
+	if s == nil {
+		return
+	}
+	l := newLocals(advice)
+	names := map[any]string{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		orig, _ := origins[ident].(*ast.Ident)
+		local := l.of(orig)
+		if local == nil {
+			return true
+		}
+		if _, ok := names[local]; !ok {
+			names[local] = s.Declare(ident.Name)
+		}
+		ident.Name = names[local]
+		return true
+	})
+}
+
+func adviceBody(advice aspect.Advice) *ast.BlockStmt {
+	if advice == nil || advice.Func() == nil {
+		return nil
+	}
+	return advice.Func().Body
+}
+
+// locals finds the locals declared in the body of advice, by the type information of advice
+// if it was type checked, by the objects of the parser otherwise.
+type locals struct {
+	body *ast.BlockStmt
+	info *types.Info
+	// keys of struct literals and selected names, which the parser resolves to locals of the same name
+	keys map[*ast.Ident]struct{}
+}
+
+func newLocals(advice aspect.Advice) *locals {
+	l := &locals{body: adviceBody(advice), info: advice.TypesInfo(), keys: map[*ast.Ident]struct{}{}}
+	if l.info != nil {
+		return l
+	}
+	ast.Inspect(l.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			l.keys[n.Sel] = struct{}{}
+		case *ast.CompositeLit:
+			// keys of map literals are expressions
+			if _, ok := n.Type.(*ast.MapType); ok {
+				return true
+			}
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if ident, ok := kv.Key.(*ast.Ident); ok {
+						l.keys[ident] = struct{}{}
+					}
+				}
+			}
+		}
+		return true
+	})
+	return l
+}
+
+// of returns the declaration of the local ident, an identifier of the body, refers to,
+// nil if it is not a local. Fields and methods of types declared in the body are not locals.
+func (l *locals) of(ident *ast.Ident) any {
+	if ident == nil || l.body == nil {
+		return nil
+	}
+	if l.info == nil {
+		if _, ok := l.keys[ident]; ok || !isLocal(l.body, ident) {
+			return nil
+		}
+		return ident.Obj
+	}
+	// the symbolic variable of a type switch is defined without an object, the variables of its
+	// clauses are declared at its position
+	pos := ident.Pos()
+	obj, ok := l.info.Defs[ident]
+	if !ok {
+		obj = l.info.Uses[ident]
+	}
+	switch obj := obj.(type) {
+	case nil:
+		if !ok {
+			return nil
+		}
+	case *types.Var:
+		if obj.IsField() {
+			return nil
+		}
+		pos = obj.Pos()
+	case *types.Func, *types.PkgName:
+		return nil
+	default:
+		pos = obj.Pos()
+	}
+	if pos < l.body.Pos() || pos >= l.body.End() {
+		return nil
+	}
+	return pos
+}
+
+// isLocal reports whether ident refers to an object declared in body.
+func isLocal(body *ast.BlockStmt, ident *ast.Ident) bool {
+	if ident.Obj == nil || ident.Obj.Kind == ast.Pkg {
+		return false
+	}
+	decl, ok := ident.Obj.Decl.(ast.Node)
+	if !ok {
+		return false
+	}
+	return decl.Pos() >= body.Pos() && decl.End() <= body.End()
+}
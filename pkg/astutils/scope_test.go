@@ -0,0 +1,128 @@
+package astutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScope_Declare(t *testing.T) {
+	s := NewScope("p", "ctx", "r0", "r1")
+	s.Reserve("err", "err1")
+	tests := []struct {
+		name, want string
+	}{
+		{"result", "result"},
+		{"result", "result1"},
+		{"result", "result2"},
+		{"ctx", "ctx1"},
+		{"err", "err2"},
+		{"r0", "r01"},
+		{"_", "_"},
+		{"_", "_"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, s.Declare(tt.name), tt.name)
+	}
+}
+
+func TestScope_rename(t *testing.T) {
+	method, advice := parseAdvice(t, `import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+type S struct{}
+
+var result = "global"
+
+func (s *S) M(name string) error { return nil }
+
+func (S) Around(pjp aspect.ProceedingJoinpoint) []any {
+	err := fmt.Errorf("around")
+	pjp.Proceed()
+	for i, name := range []string{"a"} {
+		fmt.Println(i, name, err)
+	}
+	return pjp.Results()
+}
+
+func (S) Before(jp aspect.Joinpoint) {
+	err := fmt.Errorf("before")
+	fmt.Println(err, result, func(err error) error { return err }(err))
+}
+
+func (S) After(jp aspect.Joinpoint) {
+	fmt, result := 1, 2
+	_, _ = fmt, result
+}
+`)
+	names, _ := method.GetParams()
+	results, _ := method.GetResults()
+	scope := NewScope(append(append([]string{"p"}, names...), results...)...)
+	for _, v := range advice {
+		scope.ReserveAdvice(v)
+	}
+	aroundBefore, aroundAfter, err := weaveAdvice(advice["Around"], method, scope, true)
+	assert.NoError(t, err)
+	before, _, err := weaveAdvice(advice["Before"], method, scope, false)
+	assert.NoError(t, err)
+	after, _, err := weaveAdvice(advice["After"], method, scope, false)
+	assert.NoError(t, err)
+
+	// params, results, package names and package level declarations referred to by advice are kept
+	assert.Equal(t, `err := fmt.Errorf("around")`, strings.Join(aroundBefore, "\n"))
+	assert.Equal(t, `for i, name1 := range []string{"a"} {
+	fmt.Println(i, name1, err)
+}`, strings.Join(aroundAfter, "\n"))
+	assert.Equal(t, `err1 := fmt.Errorf("before")
+fmt.Println(err1, result, func(err2 error) error {
+	return err2
+}(err1))`, strings.Join(before, "\n"))
+	assert.Equal(t, `fmt1, result1 := 1, 2
+_, _ = fmt1, result1`, strings.Join(after, "\n"))
+}
+
+func TestScope_renameKeys(t *testing.T) {
+	method, advice := parseAdvice(t, `import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+type S struct{}
+
+type pair struct{ n int }
+
+func (s *S) M(n int) {}
+
+func (S) Before(jp aspect.Joinpoint) {
+	n := len(jp.Params())
+	m := map[int]int{n: n}
+	switch v := any(n).(type) {
+	case int:
+		fmt.Println(pair{n: n}, pair{n}.n, m, v)
+	}
+}
+`)
+	decl := advice["Before"].Func()
+	for name, v := range map[string]aspect.Advice{
+		"types":  advice["Before"],
+		"parser": aspect.NewAdvice(aspect.WithAdviceDecl(decl)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			before, _, err := weaveAdvice(v, method, NewScope("p", "n", "v"), false)
+			assert.NoError(t, err)
+			// keys of struct literals and selected fields keep their names
+			assert.Equal(t, `n1 := len([]interface{}{n})
+m := map[int]int{n1: n1}
+switch v1 := any(n1).(type) {
+case int:
+	fmt.Println(pair{n: n1}, pair{n1}.n, m, v1)
+}`, strings.Join(before, "\n"))
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package astutils
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+// importRecorder qualifies types of other packages by the name the file imports them with,
+// and records the imports which are needed.
+type importRecorder struct {
+	self    *types.Package
+	aliases map[string]string // import path to name
+	seen    map[string]struct{}
+	specs   []*ast.ImportSpec
+}
+
+func newImportRecorder(self *types.Package, imports map[string]string) *importRecorder {
+	r := &importRecorder{
+		self:    self,
+		aliases: map[string]string{},
+		seen:    map[string]struct{}{},
+	}
+	for name, p := range imports {
+		r.aliases[p] = name
+	}
+	return r
+}
+
+func (r *importRecorder) qualify(pkg *types.Package) string {
+	if pkg == r.self || (r.self != nil && pkg.Path() == r.self.Path()) {
+		return ""
+	}
+	name, ok := r.aliases[pkg.Path()]
+	if !ok || name == "_" {
+		name = pkg.Name()
+	}
+	if _, ok := r.seen[pkg.Path()]; !ok {
+		r.seen[pkg.Path()] = struct{}{}
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(pkg.Path())}}
+		if name != path.Base(pkg.Path()) {
+			spec.Name = ast.NewIdent(name)
+		}
+		r.specs = append(r.specs, spec)
+	}
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// typeString renders the type of v, the last param of a variadic signature as ...T.
+func (r *importRecorder) typeString(v *types.Var, variadic bool) string {
+	if variadic {
+		if s, ok := v.Type().(*types.Slice); ok {
+			return "..." + types.TypeString(s.Elem(), r.qualify)
+		}
+	}
+	return types.TypeString(v.Type(), r.qualify)
+}
+
+// MethodSignature renders params and results of fn from type information, qualified by the
+// names of imports, which maps names to paths as File.Imports, and records the imports in use.
+// Unnamed and blank params are named a0, a1 and results r0, r1 by position.
+func MethodSignature(fn *types.Func, imports map[string]string) *aspect.Signature {
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok {
+		return nil
+	}
+	r := newImportRecorder(fn.Pkg(), imports)
+	s := &aspect.Signature{Variadic: sig.Variadic(), Types: sig}
+	for i := 0; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		name := v.Name()
+		if len(name) == 0 || name == "_" {
+			name = fmt.Sprintf("a%d", i)
+		}
+		variadic := sig.Variadic() && i == sig.Params().Len()-1
+		s.ParamNames = append(s.ParamNames, name)
+		s.Params = append(s.Params, name+" "+r.typeString(v, variadic))
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		v := sig.Results().At(i)
+		name := v.Name()
+		if len(name) == 0 || name == "_" {
+			name = fmt.Sprintf("r%d", i)
+		}
+		s.ResultNames = append(s.ResultNames, name)
+		s.Results = append(s.Results, name+" "+r.typeString(v, false))
+	}
+	s.Imports = r.specs
+	return s
+}
@@ -0,0 +1,124 @@
+package astutils
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sourceImporter is shared by the tests to import packages from source once.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+func TestMethodSignature(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", `package p
+
+import (
+	"context"
+	stdio "io"
+	"io/fs"
+	"time"
+)
+
+var _ = time.Now
+
+type S struct{}
+
+type Item struct{}
+
+func (s *S) Funcs(ctx context.Context, fn func(int, ...string) (bool, error), h fs.WalkDirFunc) {}
+
+func (s *S) Containers(m map[string][]*Item, ch <-chan struct{}, arr [4]byte) (out chan<- int) { return }
+
+func (s *S) Anonymous(v struct{ A, B int }, w interface{ Write([]byte) (int, error) }) interface{} { return nil }
+
+func (s *S) Aliased(r stdio.Reader, _ int) (n int64, _ error) { return }
+
+func (s *S) Variadic(format string, args ...any) {}
+
+func (s *S) Unused() {}
+`, 0)
+	assert.NoError(t, err)
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("example.com/p", fset, []*ast.File{file}, info)
+	assert.NoError(t, err)
+	imports := map[string]string{"context": "context", "stdio": "io", "fs": "io/fs", "time": "time"}
+
+	tests := []struct {
+		method            string
+		params, results   []string
+		paramNames, names []string
+		imports           []string
+		variadic          bool
+	}{
+		{
+			method:     "Funcs",
+			params:     []string{"ctx context.Context", "fn func(int, ...string) (bool, error)", "h fs.WalkDirFunc"},
+			paramNames: []string{"ctx", "fn", "h"},
+			imports:    []string{`"context"`, `"io/fs"`},
+		},
+		{
+			method:     "Containers",
+			params:     []string{"m map[string][]*Item", "ch <-chan struct{}", "arr [4]byte"},
+			paramNames: []string{"m", "ch", "arr"},
+			results:    []string{"out chan<- int"},
+			names:      []string{"out"},
+		},
+		{
+			method:     "Anonymous",
+			params:     []string{"v struct{A int; B int}", "w interface{Write([]byte) (int, error)}"},
+			paramNames: []string{"v", "w"},
+			results:    []string{"r0 interface{}"},
+			names:      []string{"r0"},
+		},
+		{
+			method:     "Aliased",
+			params:     []string{"r stdio.Reader", "a1 int"},
+			paramNames: []string{"r", "a1"},
+			results:    []string{"n int64", "r1 error"},
+			names:      []string{"n", "r1"},
+			imports:    []string{`stdio "io"`},
+		},
+		{
+			method:     "Variadic",
+			params:     []string{"format string", "args ...any"},
+			paramNames: []string{"format", "args"},
+			variadic:   true,
+		},
+		{
+			method: "Unused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			var fn *types.Func
+			for ident, obj := range info.Defs {
+				if f, ok := obj.(*types.Func); ok && ident.Name == tt.method {
+					fn = f
+				}
+			}
+			sig := MethodSignature(fn, imports)
+			assert.Equal(t, tt.params, sig.Params)
+			assert.Equal(t, tt.paramNames, sig.ParamNames)
+			assert.Equal(t, tt.results, sig.Results)
+			assert.Equal(t, tt.names, sig.ResultNames)
+			assert.Equal(t, tt.variadic, sig.Variadic)
+			assert.NotNil(t, sig.Types)
+			var specs []string
+			for _, v := range sig.Imports {
+				spec := v.Path.Value
+				if v.Name != nil {
+					spec = v.Name.Name + " " + spec
+				}
+				specs = append(specs, spec)
+			}
+			assert.Equal(t, tt.imports, specs)
+		})
+	}
+}
@@ -0,0 +1,659 @@
+package astutils
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// aspectPkgPath declares Joinpoint and ProceedingJoinpoint.
+const aspectPkgPath = "github.com/go-park/sandwich/pkg/aspect"
+
+// ParseAdviceStmt returns the statements of before or after advice inlined into method,
+// locals declared by advice are renamed if scope is in use of their names.
+func ParseAdviceStmt(advice aspect.Advice, method aspect.Method, scope *Scope) ([]string, error) {
+	stmts, _, err := weaveAdvice(advice, method, scope, false)
+	return stmts, err
+}
+
+// ParseAroundAdvice returns the statements of around advice before and after the call of Proceed.
+func ParseAroundAdvice(advice aspect.Advice, method aspect.Method, scope *Scope) ([]string, []string, error) {
+	return weaveAdvice(advice, method, scope, true)
+}
+
+// adviceWeaver rewrites a copy of the body of advice for one method: calls of the joinpoint are
+// substituted by the params, results and name of the method, and the call of Proceed is split off.
+type adviceWeaver struct {
+	advice   aspect.Advice
+	method   aspect.Method
+	around   bool
+	info     *types.Info
+	jp       *ast.Object // the joinpoint param
+	result   *ast.Object // the first named result, result[i] is the i-th result of the method
+	origins  map[ast.Node]ast.Node
+	returns  map[*ast.ReturnStmt]struct{} // returns of the advice, not of function literals in it
+	proceeds int
+	at       ast.Stmt // is the call of the parent, the body is split around it
+	// the local the results of Proceed are assigned to, which is substituted by the results of the method
+	proceeded *ast.Object
+	body      *ast.BlockStmt
+	err       error
+
+	paramNames, params, resultNames, results []string
+}
+
+func weaveAdvice(advice aspect.Advice, method aspect.Method, scope *Scope, around bool) ([]string, []string, error) {
+	if advice == nil || advice.Func() == nil || advice.Func().Body == nil {
+		return nil, nil, nil
+	}
+	w := &adviceWeaver{
+		advice:  advice,
+		method:  method,
+		around:  around,
+		info:    advice.TypesInfo(),
+		origins: map[ast.Node]ast.Node{},
+	}
+	w.paramNames, w.params = method.GetParams()
+	w.resultNames, w.results = method.GetResults()
+	decl := advice.Func()
+	if params := decl.Type.Params; params != nil && len(params.List) > 0 && len(params.List[0].Names) > 0 {
+		w.jp = params.List[0].Names[0].Obj
+	}
+	if results := decl.Type.Results; results != nil && len(results.List) > 0 && len(results.List[0].Names) > 0 {
+		w.result = results.List[0].Names[0].Obj
+	}
+	body := w.clone(decl.Body).(*ast.BlockStmt)
+	scope.rename(advice, body, w.origins)
+	// the advice returns what the proxy method returns anyway
+	if n := len(body.List); n > 0 {
+		if _, ok := body.List[n-1].(*ast.ReturnStmt); ok {
+			body.List = body.List[:n-1]
+		}
+	}
+	w.returns = adviceReturns(body)
+	w.body = body
+	astutil.Apply(body, w.pre, w.post)
+	w.checkJoinpoint(body)
+	if w.err != nil {
+		return nil, nil, w.err
+	}
+	if !around && len(w.returns) > 0 {
+		// early returns of before and after advice leave the advice only
+		body = &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+			Fun: &ast.FuncLit{Type: &ast.FuncType{Params: &ast.FieldList{}}, Body: body},
+		}}}}
+	}
+	before, after := w.split(body.List)
+	return before, after, nil
+}
+
+// split prints the statements of list before and after the call of Proceed. If the call is nested
+// in a statement of list, the statement is split around the statement list the call is nested in.
+func (w *adviceWeaver) split(list []ast.Stmt) ([]string, []string) {
+	for i, stmt := range list {
+		if w.at == nil || !contains(stmt, w.at) {
+			continue
+		}
+		before, after := printStmts(list[:i]), printStmts(list[i+1:])
+		if stmt == w.at {
+			return before, after
+		}
+		inner := nestedList(stmt, w.at)
+		innerBefore, innerAfter := w.split(*inner)
+		open, close := enclosing(stmt, inner)
+		before = append(append(before, open), innerBefore...)
+		// a case clause has no closing
+		if len(close) > 0 {
+			innerAfter = append(innerAfter, close)
+		}
+		return before, append(innerAfter, after...)
+	}
+	return printStmts(list), nil
+}
+
+func (w *adviceWeaver) errorf(format string, args ...any) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (w *adviceWeaver) pre(c *astutil.Cursor) bool {
+	switch n := c.Node().(type) {
+	case ast.Stmt:
+		if !w.callsProceed(n) {
+			return true
+		}
+		w.proceeds++
+		switch {
+		case !isSimpleStmt(n):
+			w.errorf("Proceed of %s must be called in a statement of its own", w.advice.Name())
+		case !w.around:
+			w.errorf("Proceed of %s called outside around advice", w.advice.Name())
+		case w.proceeds > 1:
+			w.errorf("Proceed called more than once in %s", w.advice.Name())
+		case c.Index() < 0:
+			w.errorf("Proceed of %s must be called in a statement of its own", w.advice.Name())
+		default:
+			w.at = &ast.EmptyStmt{Implicit: true}
+			return w.proceed(c, n)
+		}
+		return false
+	case *ast.Ident:
+		// result of result := pjp.Proceed()
+		if w.proceeded != nil && n.Obj == w.proceeded {
+			c.Replace(anyList(w.resultNames, n.Pos()))
+		}
+		return false
+	case *ast.TypeAssertExpr:
+		// jp.ParamTo(1).(context.Context)
+		call, ok := n.X.(*ast.CallExpr)
+		if !ok || !w.isJoinpointCall(call) {
+			return true
+		}
+		name := call.Fun.(*ast.SelectorExpr).Sel.Name
+		if name != "ParamTo" && name != "ResultTo" {
+			return true
+		}
+		if v, ok := w.indexed(call, name, n.Type); ok {
+			c.Replace(v)
+		}
+		return false
+	case *ast.CallExpr:
+		if !w.isJoinpointCall(n) {
+			return true
+		}
+		switch name := n.Fun.(*ast.SelectorExpr).Sel.Name; name {
+		case "FuncName":
+			c.Replace(&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(w.method.Name())})
+		case "Params":
+			c.Replace(anyList(w.paramNames, n.Pos()))
+		case "Results":
+			c.Replace(anyList(w.resultNames, n.Pos()))
+		case "ParamTo", "ResultTo":
+			if v, ok := w.indexed(n, name, nil); ok {
+				c.Replace(v)
+			}
+		}
+		return false
+	case *ast.IndexExpr:
+		// result[2] of the named result of around advice
+		ident, ok := n.X.(*ast.Ident)
+		if !ok || w.result == nil || ident.Obj != w.result {
+			return true
+		}
+		i, ok := intLit(n.Index)
+		if !ok || i < 1 || i > len(w.resultNames) {
+			w.errorf("%s[%s] out of range, %s has %d results",
+				ident.Name, types.ExprString(n.Index), w.method.Name(), len(w.resultNames))
+			return false
+		}
+		c.Replace(ast.NewIdent(w.resultNames[i-1]))
+		return false
+	}
+	return true
+}
+
+// proceed replaces stmt, the statement calling Proceed, by the call of the parent, after which the results
+// of Proceed are those of the method. A local defined by the results, and not assigned again, is substituted
+// by them, like pjp.Results(), other statements using the results follow the call with the results substituted.
+func (w *adviceWeaver) proceed(c *astutil.Cursor, stmt ast.Stmt) bool {
+	switch n := stmt.(type) {
+	case *ast.ExprStmt:
+		if w.isProceed(n.X) {
+			c.Replace(w.at)
+			return false
+		}
+	case *ast.DeferStmt:
+		if w.isProceed(n.Call) {
+			c.Replace(w.at)
+			return false
+		}
+	case *ast.GoStmt:
+		if w.isProceed(n.Call) {
+			c.Replace(w.at)
+			return false
+		}
+	}
+	if ident := w.boundByProceed(stmt); ident != nil && !w.assigned(ident) {
+		w.proceeded = ident.Obj
+		c.Replace(w.at)
+		return false
+	}
+	c.InsertBefore(w.at)
+	astutil.Apply(stmt, func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.FuncLit:
+			return false
+		case ast.Expr:
+			if w.isProceed(n) {
+				c.Replace(anyList(w.resultNames, n.Pos()))
+				return false
+			}
+		}
+		return true
+	}, nil)
+	// the rest of the statement is substituted as any other
+	return true
+}
+
+// isProceed reports a call of Proceed of the joinpoint.
+func (w *adviceWeaver) isProceed(expr ast.Expr) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || !w.isJoinpointCall(call) {
+		return false
+	}
+	return call.Fun.(*ast.SelectorExpr).Sel.Name == "Proceed"
+}
+
+// boundByProceed returns the local of result := pjp.Proceed() or var result = pjp.Proceed(),
+// or the named result of results = pjp.Proceed(), nil otherwise.
+func (w *adviceWeaver) boundByProceed(stmt ast.Stmt) *ast.Ident {
+	var lhs, rhs []ast.Expr
+	define := true
+	switch n := stmt.(type) {
+	case *ast.AssignStmt:
+		lhs, rhs, define = n.Lhs, n.Rhs, n.Tok == token.DEFINE
+	case *ast.DeclStmt:
+		gen, ok := n.Decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR || len(gen.Specs) != 1 {
+			return nil
+		}
+		spec := gen.Specs[0].(*ast.ValueSpec)
+		for _, v := range spec.Names {
+			lhs = append(lhs, v)
+		}
+		rhs = spec.Values
+	}
+	if len(lhs) != 1 || len(rhs) != 1 || !w.isProceed(rhs[0]) {
+		return nil
+	}
+	ident, ok := lhs[0].(*ast.Ident)
+	if !ok || ident.Obj == nil || (!define && ident.Obj != w.result) {
+		return nil
+	}
+	return ident
+}
+
+// assigned reports whether the local def is assigned, incremented, has its elements assigned
+// or its address taken after its definition. Elements of the named result are results of the method.
+func (w *adviceWeaver) assigned(def *ast.Ident) bool {
+	found := false
+	target := func(expr ast.Expr) {
+		if index, ok := expr.(*ast.IndexExpr); ok {
+			if ident, ok := index.X.(*ast.Ident); ok && w.result != nil && ident.Obj == w.result {
+				return
+			}
+		}
+		for {
+			switch n := expr.(type) {
+			case *ast.ParenExpr:
+				expr = n.X
+				continue
+			case *ast.IndexExpr:
+				expr = n.X
+				continue
+			case *ast.SliceExpr:
+				expr = n.X
+				continue
+			case *ast.Ident:
+				if n != def && n.Obj == def.Obj {
+					found = true
+				}
+			}
+			return
+		}
+	}
+	ast.Inspect(w.body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, v := range n.Lhs {
+				target(v)
+			}
+		case *ast.IncDecStmt:
+			target(n.X)
+		case *ast.RangeStmt:
+			if n.Key != nil {
+				target(n.Key)
+			}
+			if n.Value != nil {
+				target(n.Value)
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				target(n.X)
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// expandReturn makes return []any{0, err} or return pjp.Results() of around advice return the
+// results of the method, the latter is substituted by []interface{}{r0, r1} before.
+func (w *adviceWeaver) expandReturn(ret *ast.ReturnStmt) {
+	if _, ok := w.returns[ret]; !ok || len(ret.Results) != 1 {
+		return
+	}
+	lit, ok := ret.Results[0].(*ast.CompositeLit)
+	if ok && isAnySlice(lit.Type) && len(lit.Elts) == len(w.resultNames) {
+		ret.Results = lit.Elts
+	}
+}
+
+// post expands returns of results and removes assignments made redundant by substitution, like ctx := ctx.
+func (w *adviceWeaver) post(c *astutil.Cursor) bool {
+	if ret, ok := c.Node().(*ast.ReturnStmt); ok {
+		w.expandReturn(ret)
+		return true
+	}
+	assign, ok := c.Node().(*ast.AssignStmt)
+	if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 || c.Index() < 0 {
+		return true
+	}
+	lhs, ok1 := assign.Lhs[0].(*ast.Ident)
+	rhs, ok2 := assign.Rhs[0].(*ast.Ident)
+	if ok1 && ok2 && lhs.Name == rhs.Name {
+		c.Delete()
+	}
+	return true
+}
+
+// indexed substitutes ParamTo(i) or ResultTo(i) by the i-th param or result of the method,
+// typ is the asserted type, nil if there is no assertion.
+func (w *adviceWeaver) indexed(call *ast.CallExpr, name string, typ ast.Expr) (ast.Expr, bool) {
+	names, decls, kind := w.paramNames, w.params, "params"
+	if name == "ResultTo" {
+		names, decls, kind = w.resultNames, w.results, "results"
+	}
+	if len(call.Args) != 1 {
+		w.errorf("%s of %s needs one index", name, w.advice.Name())
+		return nil, false
+	}
+	i, ok := intLit(call.Args[0])
+	if !ok {
+		w.errorf("%s(%s) of %s needs a constant index", name, types.ExprString(call.Args[0]), w.advice.Name())
+		return nil, false
+	}
+	if i < 1 || i > len(names) {
+		w.errorf("%s(%d) out of range, %s has %d %s", name, i, w.method.Name(), len(names), kind)
+		return nil, false
+	}
+	if typ != nil && !w.asserts(typ, name, i, decls[i-1]) {
+		w.errorf("%s(%d).(%s) does not match %s %q of %s", name, i, types.ExprString(typ),
+			strings.TrimSuffix(kind, "s"), decls[i-1], w.method.Name())
+		return nil, false
+	}
+	return ast.NewIdent(names[i-1]), true
+}
+
+// asserts reports whether typ is the type of the i-th param or result declared by decl, which is
+// compared by type information if the advice and the method are type checked, by source otherwise.
+func (w *adviceWeaver) asserts(typ ast.Expr, name string, i int, decl string) bool {
+	if sig := w.method.Types(); sig != nil && w.info != nil {
+		if orig, ok := w.origins[typ].(ast.Expr); ok {
+			if t := w.info.TypeOf(orig); t != nil {
+				vars := sig.Params()
+				if name == "ResultTo" {
+					vars = sig.Results()
+				}
+				return types.Identical(t, vars.At(i-1).Type())
+			}
+		}
+	}
+	_, declType, _ := strings.Cut(decl, " ")
+	if name == "ParamTo" && strings.HasPrefix(declType, "...") {
+		// args ...T is asserted as its slice
+		declType = "[]" + strings.TrimPrefix(declType, "...")
+	}
+	src := types.ExprString(typ)
+	return declType == src || strings.HasSuffix(declType, "."+src)
+}
+
+// isJoinpointCall reports a method call of the joinpoint, by its type or by the param of the advice.
+func (w *adviceWeaver) isJoinpointCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	if ident, ok := sel.X.(*ast.Ident); ok && w.jp != nil && ident.Obj == w.jp {
+		return true
+	}
+	if w.info == nil {
+		return false
+	}
+	orig, ok := w.origins[sel.X].(ast.Expr)
+	return ok && isJoinpointType(w.info.TypeOf(orig))
+}
+
+// callsProceed reports whether stmt calls Proceed of the joinpoint, not counting the bodies
+// of nested statements and function literals.
+func (w *adviceWeaver) callsProceed(stmt ast.Stmt) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit, *ast.BlockStmt:
+			return false
+		case ast.Stmt:
+			return n == stmt
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Proceed" && w.isJoinpointCall(n) {
+				found = true
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// checkJoinpoint reports uses of the joinpoint which are not substituted, the proxy has no joinpoint.
+func (w *adviceWeaver) checkJoinpoint(body *ast.BlockStmt) {
+	if w.jp == nil {
+		return
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Obj == w.jp {
+			w.errorf("%s of %s is used other than by calling FuncName, Params, Results, ParamTo, ResultTo or Proceed",
+				ident.Name, w.advice.Name())
+		}
+		return w.err == nil
+	})
+}
+
+// clone copies node deeply and records the original of every copied node,
+// objects, scopes and comments are shared.
+func (w *adviceWeaver) clone(node ast.Node) ast.Node {
+	return w.cloneValue(reflect.ValueOf(node)).Interface().(ast.Node)
+}
+
+var (
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	scopeType        = reflect.TypeOf((*ast.Scope)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+func (w *adviceWeaver) cloneValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == objectType || v.Type() == scopeType || v.Type() == commentGroupType {
+			return v
+		}
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(w.cloneValue(v.Elem()))
+		if n, ok := v.Interface().(ast.Node); ok {
+			w.origins[c.Interface().(ast.Node)] = n
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(w.cloneValue(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(w.cloneValue(v.Index(i)))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(w.cloneValue(v.Field(i)))
+		}
+		return c
+	}
+	return v
+}
+
+// isSimpleStmt reports a statement without nested statements, which may be replaced by the call of the parent.
+func isSimpleStmt(stmt ast.Stmt) bool {
+	switch stmt.(type) {
+	case *ast.ExprStmt, *ast.AssignStmt, *ast.DeclStmt, *ast.ReturnStmt, *ast.DeferStmt, *ast.GoStmt, *ast.SendStmt, *ast.IncDecStmt:
+		return true
+	}
+	return false
+}
+
+func isJoinpointType(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != aspectPkgPath {
+		return false
+	}
+	return named.Obj().Name() == "Joinpoint" || named.Obj().Name() == "ProceedingJoinpoint"
+}
+
+// adviceReturns returns the returns of the advice itself, not of function literals in it.
+func adviceReturns(body *ast.BlockStmt) map[*ast.ReturnStmt]struct{} {
+	returns := map[*ast.ReturnStmt]struct{}{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			returns[n] = struct{}{}
+		}
+		return true
+	})
+	return returns
+}
+
+// isAnySlice reports []any or []interface{}.
+func isAnySlice(expr ast.Expr) bool {
+	arr, ok := expr.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	switch elt := arr.Elt.(type) {
+	case *ast.Ident:
+		return elt.Name == "any"
+	case *ast.InterfaceType:
+		return elt.Methods == nil || len(elt.Methods.List) == 0
+	}
+	return false
+}
+
+// anyList is []interface{}{names...}, the braces of interface at pos keep it on one line.
+func anyList(names []string, pos token.Pos) ast.Expr {
+	methods := &ast.FieldList{Opening: pos, Closing: pos}
+	lit := &ast.CompositeLit{Type: &ast.ArrayType{Elt: &ast.InterfaceType{Methods: methods}}}
+	for _, v := range names {
+		lit.Elts = append(lit.Elts, ast.NewIdent(v))
+	}
+	return lit
+}
+
+func intLit(expr ast.Expr) (int, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.INT {
+		return 0, false
+	}
+	i, err := strconv.Atoi(lit.Value)
+	return i, err == nil
+}
+
+func printNode(node ast.Node) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, token.NewFileSet(), node)
+	return buf.String()
+}
+
+func printStmts(list []ast.Stmt) []string {
+	var stmts []string
+	for _, stmt := range list {
+		stmts = append(stmts, printNode(stmt))
+	}
+	return stmts
+}
+
+// contains reports whether node is or contains target.
+func contains(node, target ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == target {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// nestedList returns the outermost statement list in stmt which contains target.
+func nestedList(stmt ast.Stmt, target ast.Node) *[]ast.Stmt {
+	var list *[]ast.Stmt
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		if list != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			if contains(n, target) {
+				list = &n.List
+			}
+		case *ast.CaseClause:
+			if contains(n, target) {
+				list = &n.Body
+			}
+		case *ast.CommClause:
+			if contains(n, target) {
+				list = &n.Body
+			}
+		}
+		return list == nil
+	})
+	return list
+}
+
+// enclosing prints stmt around the statements of list, like "err := f(func() error {" and "})".
+// stmt is printed with a placeholder in place of list twice, and the prints differ where it is.
+func enclosing(stmt ast.Stmt, list *[]ast.Stmt) (string, string) {
+	saved := *list
+	defer func() { *list = saved }()
+	*list = []ast.Stmt{&ast.ExprStmt{X: ast.NewIdent("a")}}
+	a := printNode(stmt)
+	*list = []ast.Stmt{&ast.ExprStmt{X: ast.NewIdent("b")}}
+	b := printNode(stmt)
+	i := 0
+	for a[i] == b[i] {
+		i++
+	}
+	return strings.TrimSpace(a[:i]), strings.TrimSpace(a[i+1:])
+}
@@ -0,0 +1,344 @@
+package astutils
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/stretchr/testify/assert"
+)
+
+// parseAdvice type checks src, a file of package p declaring the method M and advice,
+// and returns M and the advice by name.
+func parseAdvice(t *testing.T, src string) (aspect.Method, map[string]aspect.Advice) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.go", "package p\n\n"+src, parser.ParseComments)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	conf := types.Config{Importer: sourceImporter}
+	if _, err := conf.Check("p", fset, []*ast.File{file}, info); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	imports := map[string]string{}
+	for _, v := range file.Imports {
+		p, _ := strconv.Unquote(v.Path.Value)
+		name := p[strings.LastIndex(p, "/")+1:]
+		if v.Name != nil {
+			name = v.Name.Name
+		}
+		imports[name] = p
+	}
+	var method aspect.Method
+	advice := map[string]aspect.Advice{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		if fn.Name.Name == "M" {
+			method = aspect.NewMethod(aspect.WithMethodDecl(fn),
+				aspect.WithMethodSignature(MethodSignature(info.Defs[fn.Name].(*types.Func), imports)))
+			continue
+		}
+		advice[fn.Name.Name] = aspect.NewAdvice(aspect.WithAdviceDecl(fn), aspect.WithAdviceTypesInfo(info))
+	}
+	return method, advice
+}
+
+// weave weaves the advice A of src into the method M, see parseAdvice.
+func weave(t *testing.T, src string, around bool) (string, string, error) {
+	t.Helper()
+	method, advice := parseAdvice(t, src)
+	names, _ := method.GetParams()
+	results, _ := method.GetResults()
+	before, after, err := weaveAdvice(advice["A"], method, NewScope(append(names, results...)...), around)
+	return strings.Join(before, "\n"), strings.Join(after, "\n"), err
+}
+
+func TestWeaveAdvice(t *testing.T) {
+	const header = `import (
+	"context"
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+var (
+	_ = context.Background
+	_ = fmt.Sprint
+)
+
+type S struct{}
+
+type Context int
+
+type Ctx = context.Context
+`
+	tests := []struct {
+		name          string
+		src           string
+		around        bool
+		before, after string
+		err           string
+	}{
+		{
+			name: "params and results",
+			src: `func (s *S) M(ctx context.Context, name string) (int, error) { return 0, nil }
+func (S) A(jp aspect.Joinpoint) {
+	fmt.Println(jp.FuncName(), jp.Params(), jp.ParamTo(2).(string))
+}`,
+			before: `fmt.Println("M", []interface{}{ctx, name}, name)`,
+		},
+		{
+			name: "assertion by an alias of the type",
+			src: `func (s *S) M(ctx context.Context) {}
+func (S) A(jp aspect.Joinpoint) {
+	_ = jp.ParamTo(1).(Ctx)
+}`,
+			before: `_ = ctx`,
+		},
+		{
+			name: "assertion of a type of the same name",
+			src: `func (s *S) M(ctx context.Context) {}
+func (S) A(jp aspect.Joinpoint) {
+	_ = jp.ParamTo(1).(Context)
+}`,
+			err: `ParamTo(1).(Context) does not match param "ctx context.Context" of M`,
+		},
+		{
+			name: "variadic asserted as slice",
+			src: `func (s *S) M(args ...int) {}
+func (S) A(jp aspect.Joinpoint) {
+	fmt.Println(jp.ParamTo(1).([]int))
+}`,
+			before: `fmt.Println(args)`,
+		},
+		{
+			name: "result type mismatch",
+			src: `func (s *S) M() (int, error) { return 0, nil }
+func (S) A(jp aspect.Joinpoint) {
+	_ = jp.ResultTo(1).(string)
+}`,
+			err: `ResultTo(1).(string) does not match result "r0 int" of M`,
+		},
+		{
+			name: "ParamTo out of range",
+			src: `func (s *S) M(a, b int) {}
+func (S) A(jp aspect.Joinpoint) {
+	_ = jp.ParamTo(3)
+}`,
+			err: "ParamTo(3) out of range, M has 2 params",
+		},
+		{
+			name: "ParamTo(0)",
+			src: `func (s *S) M(a int) {}
+func (S) A(jp aspect.Joinpoint) {
+	_ = jp.ParamTo(0)
+}`,
+			err: "ParamTo(0) out of range, M has 1 params",
+		},
+		{
+			name: "ParamTo of a variable index",
+			src: `func (s *S) M(a int) {}
+func (S) A(jp aspect.Joinpoint) {
+	i := 1
+	_ = jp.ParamTo(i)
+}`,
+			err: "ParamTo(i) of A needs a constant index",
+		},
+		{
+			name: "joinpoint passed on",
+			src: `func (s *S) M() {}
+func (S) A(jp aspect.Joinpoint) {
+	fmt.Println(jp)
+}`,
+			err: "jp of A is used other than by calling FuncName, Params, Results, ParamTo, ResultTo or Proceed",
+		},
+		{
+			name: "Proceed called twice",
+			src: `func (s *S) M() {}
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	pjp.Proceed()
+	pjp.Proceed()
+	return pjp.Results()
+}`,
+			around: true,
+			err:    "Proceed called more than once in A",
+		},
+		{
+			name: "Proceed in an expression",
+			src: `func (s *S) M() int { return 0 }
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	if r := pjp.Proceed(); r != nil {
+		return r
+	}
+	return nil
+}`,
+			around: true,
+			err:    "Proceed of A must be called in a statement of its own",
+		},
+		{
+			name: "Proceed outside around advice",
+			src: `func (s *S) M() {}
+func (S) A(pjp aspect.ProceedingJoinpoint) {
+	pjp.Proceed()
+}`,
+			err: "Proceed of A called outside around advice",
+		},
+		{
+			name: "around advice split at Proceed",
+			src: `func (s *S) M(a int) (int, error) { return 0, nil }
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	if a := pjp.ParamTo(1).(int); a < 0 {
+		return []any{0, fmt.Errorf("negative")}
+	}
+	if a := pjp.ParamTo(1).(int); a == 0 {
+		return pjp.Results()
+	}
+	fmt.Println("before")
+	pjp.Proceed()
+	fmt.Println("after")
+	return pjp.Results()
+}`,
+			around: true,
+			before: `if a1 := a; a1 < 0 {
+	return 0, fmt.Errorf("negative")
+}
+if a2 := a; a2 == 0 {
+	return r0, r1
+}
+fmt.Println("before")`,
+			after: `fmt.Println("after")`,
+		},
+		{
+			name: "results of Proceed bound to a local",
+			src: `func (s *S) M() (int, error) { return 0, nil }
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	result := pjp.Proceed()
+	fmt.Println(result)
+	if len(result) > 0 {
+		return result
+	}
+	return result
+}`,
+			around: true,
+			after: `fmt.Println([]interface{}{r0, r1})
+if len([]interface{}{r0, r1}) > 0 {
+	return r0, r1
+}`,
+		},
+		{
+			name: "results of Proceed bound to a local assigned again",
+			src: `func (s *S) M() int { return 0 }
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	var result = pjp.Proceed()
+	result = append(result, 1)
+	fmt.Println(result)
+	return pjp.Results()
+}`,
+			around: true,
+			after: `var result = []interface{}{r0}
+result = append(result, 1)
+fmt.Println(result)`,
+		},
+		{
+			name: "results of Proceed used by an expression",
+			src: `func (s *S) M() int { return 0 }
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	fmt.Println("before")
+	fmt.Println(pjp.Proceed(), pjp.FuncName())
+	return pjp.Results()
+}`,
+			around: true,
+			before: `fmt.Println("before")`,
+			after:  `fmt.Println([]interface{}{r0}, "M")`,
+		},
+		{
+			name: "results of Proceed assigned to the named result",
+			src: `func (s *S) M() (int, error) { return 0, nil }
+func (S) A(pjp aspect.ProceedingJoinpoint) (results []any) {
+	results = pjp.Proceed()
+	results[2] = nil
+	fmt.Println(results, results[2])
+	return
+}`,
+			around: true,
+			after: `r1 = nil
+fmt.Println([]interface{}{r0, r1}, r1)`,
+		},
+		{
+			name: "Proceed nested in a one line function literal",
+			src: `func (s *S) M() {}
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	func() { pjp.Proceed() }()
+	return pjp.Results()
+}`,
+			around: true,
+			before: `func() {`,
+			after:  `}()`,
+		},
+		{
+			name: "Proceed nested in a case clause",
+			src: `func (s *S) M(a int) {}
+func (S) A(pjp aspect.ProceedingJoinpoint) []any {
+	switch pjp.ParamTo(1).(int) {
+	case 0:
+		fmt.Println("zero")
+	default:
+		fmt.Println("before")
+		pjp.Proceed()
+		fmt.Println("after")
+	}
+	return pjp.Results()
+}`,
+			around: true,
+			before: `switch a {
+case 0:
+	fmt.Println("zero")
+default:
+fmt.Println("before")`,
+			after: `fmt.Println("after")
+}`,
+		},
+		{
+			name: "early return of before advice",
+			src: `func (s *S) M(a int) {}
+func (S) A(jp aspect.Joinpoint) {
+	if jp.ParamTo(1).(int) < 0 {
+		return
+	}
+	fmt.Println("positive")
+}`,
+			before: `func() {
+	if a < 0 {
+		return
+	}
+	fmt.Println("positive")
+}()`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after, err := weave(t, header+tt.src, tt.around)
+			if len(tt.err) > 0 {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.before, before)
+			assert.Equal(t, tt.after, after)
+		})
+	}
+}
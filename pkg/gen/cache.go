@@ -0,0 +1,429 @@
+package gen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+// Version of the generator, part of the cache key of generated files.
+var Version = "v0.1.0"
+
+type (
+	// genCache remembers the inputs of every generated file of a module,
+	// so that unchanged proxies are neither rendered nor written again.
+	genCache struct {
+		path     string
+		Entries  map[string]cacheEntry `json:"entries"`
+		Packages map[string]pkgEntry   `json:"packages"` // by package directory
+		fileSums map[string]string
+		overlay  map[string][]byte
+		dirty    bool
+	}
+	cacheEntry struct {
+		Key    string `json:"key"`
+		Output string `json:"output"`
+		Sum    string `json:"sum"`
+	}
+	// pkgEntry remembers a generated package, which is not loaded again while its files,
+	// the files its proxies depend on and its generated files are unchanged.
+	pkgEntry struct {
+		Key        string            `json:"key"`
+		Inputs     map[string]string `json:"inputs"`  // files out of the package by sum
+		Target     string            `json:"target"`  // directory of generated files
+		Outputs    map[string]string `json:"outputs"` // generated files by sum
+		Aspects    bool              `json:"aspects"`
+		Components []cachedComponent `json:"components"`
+	}
+	// cachedComponent is a component declared by a package which is not loaded.
+	cachedComponent struct {
+		Name        string `json:"name"`
+		PkgPath     string `json:"pkgPath"`
+		PkgName     string `json:"pkgName"`
+		FactoryPkg  string `json:"factoryPkg"`
+		FactoryName string `json:"factoryName"`
+		Generic     bool   `json:"generic,omitempty"`
+		File        string `json:"file"`
+	}
+)
+
+// loadCache reads the cache of the module rooted at root, a broken or missing cache is empty.
+func loadCache(dir, root string) *genCache {
+	c := newCache()
+	if len(dir) == 0 {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return c
+		}
+		dir = filepath.Join(base, "sandwich")
+	}
+	c.path = filepath.Join(dir, hashString(root)+".json")
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(data, c); err != nil || c.Entries == nil || c.Packages == nil {
+		c.Entries = map[string]cacheEntry{}
+		c.Packages = map[string]pkgEntry{}
+	}
+	return c
+}
+
+func newCache() *genCache {
+	return &genCache{
+		Entries:  map[string]cacheEntry{},
+		Packages: map[string]pkgEntry{},
+		fileSums: map[string]string{},
+	}
+}
+
+func (c *genCache) save() error {
+	if !c.dirty || len(c.path) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	c.dirty = false
+	return os.WriteFile(c.path, data, 0o644)
+}
+
+// lookup returns the content of output when it was generated from key and is untouched since.
+func (c *genCache) lookup(id, key, output string) ([]byte, bool) {
+	e, ok := c.Entries[id]
+	if !ok || e.Key != key || e.Output != output {
+		return nil, false
+	}
+	data, err := os.ReadFile(output)
+	if err != nil || hashBytes(data) != e.Sum {
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *genCache) store(id, key, output string, data []byte) {
+	c.Entries[id] = cacheEntry{Key: key, Output: output, Sum: hashBytes(data)}
+	c.dirty = true
+}
+
+func (c *genCache) fileSum(name string) string {
+	if sum, ok := c.fileSums[name]; ok {
+		return sum
+	}
+	data, ok := c.overlay[name]
+	var err error
+	if !ok {
+		data, err = os.ReadFile(name)
+	}
+	sum := ""
+	if err == nil {
+		sum = hashBytes(data)
+	}
+	c.fileSums[name] = sum
+	return sum
+}
+
+// proxyKey hashes everything the generated file of proxy depends on: files declaring
+// the struct, its methods, the referenced aspects and the injected components,
+// build tags, generator options and version.
+func (g *Generator) proxyKey(ident *ast.Ident, proxy aspect.Proxy) string {
+	files := map[string]struct{}{}
+	addPos := func(pos token.Pos) {
+		if pos.IsValid() {
+			files[g.fset.Position(pos).Filename] = struct{}{}
+		}
+	}
+	addPos(ident.Pos())
+	if pkg, ok := g.pkgList[proxy.PkgPath()]; ok && pkg.AstPkg.TypesInfo != nil {
+		if obj := pkg.AstPkg.TypesInfo.Defs[ident]; obj != nil {
+			mset := types.NewMethodSet(types.NewPointer(obj.Type()))
+			for i := 0; i < mset.Len(); i++ {
+				addPos(mset.At(i).Obj().Pos())
+			}
+		}
+	}
+	var names []string
+	for _, cut := range proxy.GetPointcuts() {
+		names = append(names, cut.Name())
+	}
+	for _, method := range proxy.GetMethods() {
+		if method.Func() != nil {
+			addPos(method.Func().Pos())
+		}
+		for _, cut := range method.GetPointcuts() {
+			names = append(names, cut.Name())
+		}
+	}
+	var lines []string
+	for _, name := range names {
+		a, ok := g.resolveAspect(name)
+		if !ok {
+			// any package may declare it
+			if len(name) > 0 && !astutils.IsSystemAnnotation(astutils.Annotation(name)) {
+				g.volatile[proxy.PkgPath()] = true
+			}
+			lines = append(lines, "aspect "+name+" missing")
+			continue
+		}
+		lines = append(lines, "aspect "+name+" "+a.Name()+" "+string(a.Mode()))
+		for _, advice := range []aspect.Advice{a.GetBefore(), a.GetAfter(), a.GetAround()} {
+			if advice != nil && advice.Func() != nil {
+				addPos(advice.Func().Pos())
+			}
+		}
+	}
+	for _, v := range proxy.Fields() {
+		comp, instance, ok := g.lookupComponent(v.Inject())
+		if !ok {
+			if len(v.Inject()) > 0 {
+				g.volatile[proxy.PkgPath()] = true
+			}
+			continue
+		}
+		facPkg, _, facName := comp.Factory()
+		lines = append(lines, "inject "+v.Name()+" "+facPkg+"."+facName+instance)
+		// a factory renamed in another package changes the proxy
+		if len(comp.File()) > 0 {
+			files[comp.File()] = struct{}{}
+		}
+	}
+	tplPath := g.templatePath(ident, proxy)
+	if len(tplPath) > 0 {
+		files[tplPath] = struct{}{}
+	}
+	inputs := g.inputs[proxy.PkgPath()]
+	if inputs == nil {
+		inputs = map[string]struct{}{}
+		g.inputs[proxy.PkgPath()] = inputs
+	}
+	for name := range files {
+		inputs[name] = struct{}{}
+		lines = append(lines, "file "+name+" "+g.cache.fileSum(name))
+	}
+	sort.Strings(lines)
+	_, tplText, _ := g.proxyTemplate(tplPath)
+	lines = append(lines, g.optionsKey(), "template "+hashString(tplText))
+	return hashString(strings.Join(lines, "\n"))
+}
+
+// optionsKey identifies the generator and the options every generated file depends on.
+func (g *Generator) optionsKey() string {
+	return strings.Join([]string{
+		"version " + generatorVersion(),
+		"tags " + strings.Join(g.tags, ","),
+		fmt.Sprintf("options %s %t %s %s %v %s %s", g.suffix, g.singleton, g.outputName, g.outputDir,
+			g.extensions, g.syntax, g.adviceMode),
+	}, "\n")
+}
+
+// packageKey hashes the Go files of the package in dir as they are on disk, and the options.
+func (g *Generator) packageKey(dir string) string {
+	lines := []string{g.optionsKey()}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+		lines = append(lines, "file "+name+" "+hashBytes(data))
+	}
+	return hashString(strings.Join(lines, "\n"))
+}
+
+// cacheable reports whether packages unchanged since they were last generated may be left
+// unloaded. Plugins may depend on anything and overlays are not on disk.
+func (g *Generator) cacheable() bool {
+	return g.useCache && len(g.overlay) == 0 && len(g.activePlugins()) == 0
+}
+
+// skipUnchanged returns the patterns to load, without the directories of unchanged packages.
+// Packages declaring aspects are loaded along with any other package, whose proxies may weave
+// their advice, components of the others are restored from the cache.
+func (g *Generator) skipUnchanged(patterns []string) []string {
+	var list, aspects []string
+	for _, p := range patterns {
+		if !isDirPattern(p) {
+			list = append(list, p)
+			continue
+		}
+		dir := p
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(absPath(g.dir), dir)
+		}
+		dir = filepath.Clean(dir)
+		e, ok := g.cache.Packages[dir]
+		if !ok || !g.unchanged(dir, e) {
+			list = append(list, p)
+			continue
+		}
+		if e.Aspects {
+			aspects = append(aspects, p)
+		}
+		g.skipped[dir] = e
+	}
+	if len(list) > 0 {
+		for _, p := range aspects {
+			dir := p
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(absPath(g.dir), dir)
+			}
+			delete(g.skipped, filepath.Clean(dir))
+			list = append(list, p)
+		}
+	}
+	for _, e := range g.skipped {
+		for _, c := range e.Components {
+			g.componentCache[c.Name] = aspect.NewComponent(
+				aspect.WithComponentFactory(c.FactoryPkg, c.FactoryName),
+				aspect.WithComponentPkg(c.PkgPath, c.PkgName),
+				aspect.WithComponentName(c.Name),
+				aspect.WithComponentGeneric(c.Generic),
+				aspect.WithComponentFile(c.File),
+			)
+		}
+	}
+	if len(g.skipped) > 0 {
+		log.Printf("skip loading %d unchanged package(s)", len(g.skipped))
+	}
+	return list
+}
+
+// unchanged reports whether the package in dir, its inputs and generated files are as cached.
+func (g *Generator) unchanged(dir string, e pkgEntry) bool {
+	if len(e.Key) == 0 || e.Key != g.packageKey(dir) {
+		return false
+	}
+	for name, sum := range e.Inputs {
+		if g.cache.fileSum(name) != sum {
+			return false
+		}
+	}
+	for name, sum := range e.Outputs {
+		data, err := os.ReadFile(name)
+		if err != nil || hashBytes(data) != sum {
+			return false
+		}
+	}
+	return true
+}
+
+// storePackages remembers the root packages once their generated files are written,
+// packages whose proxies refer to missing aspects or components are loaded every time.
+func (g *Generator) storePackages() {
+	for _, p := range g.loaded {
+		pkg, ok := g.pkgList[p.ID]
+		if !ok {
+			continue
+		}
+		targetDir, ok := g.targetDir(pkg)
+		if !ok {
+			continue
+		}
+		dir := filepath.Dir(p.GoFiles[0])
+		if g.volatile[p.ID] {
+			delete(g.cache.Packages, dir)
+			g.cache.dirty = true
+			continue
+		}
+		e := pkgEntry{
+			Key:     g.packageKey(dir),
+			Inputs:  map[string]string{},
+			Target:  targetDir,
+			Outputs: map[string]string{},
+		}
+		for name := range g.inputs[p.ID] {
+			if filepath.Dir(name) != dir {
+				e.Inputs[name] = g.cache.fileSum(name)
+			}
+		}
+		for k, v := range pkg.OutputFiles {
+			e.Outputs[g.outputPath(pkg, targetDir, k)] = hashBytes(v)
+		}
+		for _, a := range g.aspectCache {
+			if a.PkgPath() == p.ID {
+				e.Aspects = true
+			}
+		}
+		for name, comp := range g.componentCache {
+			facPkg, _, facName := comp.Factory()
+			if facPkg == p.ID {
+				e.Components = append(e.Components, cachedComponent{
+					Name:        name,
+					PkgPath:     comp.PkgPath(),
+					PkgName:     comp.PkgName(),
+					FactoryPkg:  facPkg,
+					FactoryName: facName,
+					Generic:     comp.IsGeneric(),
+					File:        comp.File(),
+				})
+			}
+		}
+		sort.Slice(e.Components, func(i, j int) bool { return e.Components[i].Name < e.Components[j].Name })
+		g.cache.Packages[dir] = e
+		g.cache.dirty = true
+	}
+}
+
+// orphans lists generated files in the target directory of a skipped package which it does not own.
+func (e pkgEntry) orphans() []string {
+	var list []string
+	for _, name := range getGeneratedFiles(e.Target) {
+		if _, ok := e.Outputs[name]; !ok {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+var executableSum string
+
+// generatorVersion identifies the running generator, the executable is hashed
+// so that development builds invalidate the cache as well.
+func generatorVersion() string {
+	if len(executableSum) == 0 {
+		executableSum = "unknown"
+		if name, err := os.Executable(); err == nil {
+			if f, err := os.Open(name); err == nil {
+				h := sha256.New()
+				if _, err := io.Copy(h, f); err == nil {
+					executableSum = hex.EncodeToString(h.Sum(nil))
+				}
+				f.Close()
+			}
+		}
+	}
+	return Version + " " + executableSum
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hashString(s string) string {
+	return hashBytes([]byte(s))
+}
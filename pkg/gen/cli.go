@@ -0,0 +1,625 @@
+package gen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+// Exit codes of the aspect command.
+const (
+	ExitOK      = 0
+	ExitFailure = 1 // errors of generation, stale or orphaned files in check mode
+	ExitUsage   = 2
+)
+
+type (
+	// cli holds the flags of all commands, flags left unset keep values of the config file.
+	cli struct {
+		stdout io.Writer
+		stderr io.Writer
+		// options of the generator main, applied after flags
+		opts []Option
+
+		tags      string
+		deps      string
+		recursive bool
+		config    string
+		json      bool
+
+		check    bool
+		diff     bool
+		prune    bool
+		dryRun   bool
+		useCache bool
+		force    bool
+		before   bool
+		after    bool
+		around   bool
+		custom   string
+		abstract string
+		pointcut string
+		dir      string
+		interval time.Duration
+		debounce time.Duration
+		format   string
+
+		// names of flags given on the command line
+		set map[string]bool
+	}
+	command struct {
+		name    string
+		args    string
+		summary string
+		flags   []string
+		// run returns the exit code, or an error writing the output, which exits with ExitUsage
+		run func(c *cli, args []string) (int, error)
+	}
+)
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"generate", "[packages]", "generate proxies, the default command",
+			[]string{"check", "diff", "prune", "n", "cache"}, (*cli).generate},
+		{"check", "[packages]", "report stale or orphaned generated files, exit 1 if any",
+			[]string{"diff", "cache"}, (*cli).checkCmd},
+		{"clean", "[packages]", "remove generated files which no longer belong to any proxy",
+			[]string{"n"}, (*cli).clean},
+		{"list", "[packages]", "list proxies, aspects and components",
+			nil, (*cli).list},
+		{"graph", "[packages]", "print the injection graph of components",
+			[]string{"format"}, (*cli).graph},
+		{"explain", "<pkg>.<Type>.<Method> [packages]", "show the advice chain woven into a method",
+			nil, (*cli).explain},
+		{"watch", "[packages]", "generate whenever a relevant file changes",
+			[]string{"interval", "debounce", "prune", "cache"}, (*cli).watch},
+		{"new", "aspect|proxy <name>", "write the skeleton of an aspect or a proxied struct",
+			[]string{"before", "after", "around", "custom", "abstract", "pointcut", "dir", "force"}, (*cli).newCmd},
+		{"init", "[dir]", "write " + ConfigFileNames[0] + " with default values to the module root",
+			[]string{"force"}, (*cli).initConfig},
+		{"version", "", "print the generator version",
+			nil, (*cli).version},
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// Defining a flag assigns its default, current values are used as defaults
+// so that flags given before a command survive defining the flags of the command.
+var cliFlags = map[string]func(c *cli, fs *flag.FlagSet){
+	"check": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.check, "check", c.check, "report stale or orphaned generated files instead of writing them, exit 1 if any")
+	},
+	"diff": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.diff, "diff", c.diff, "like -check, and print a unified diff of the changes")
+	},
+	"prune": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.prune, "prune", c.prune, "remove generated files which no longer belong to any proxy")
+	},
+	"n": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.dryRun, "n", c.dryRun, "list orphaned generated files instead of removing them")
+	},
+	"cache": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.useCache, "cache", c.useCache, "skip proxies whose inputs are unchanged since the last run")
+	},
+	"interval": func(c *cli, fs *flag.FlagSet) {
+		fs.DurationVar(&c.interval, "interval", c.interval, "interval of polling file changes")
+	},
+	"debounce": func(c *cli, fs *flag.FlagSet) {
+		fs.DurationVar(&c.debounce, "debounce", c.debounce, "quiet period after the last change before generating")
+	},
+	"format": func(c *cli, fs *flag.FlagSet) {
+		fs.StringVar(&c.format, "format", c.format, "output format, dot, mermaid or json")
+	},
+	"force": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.force, "force", c.force, "overwrite an existing file")
+	},
+	"before": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.before, "before", c.before, "new aspect: add @Before advice, all advice if none is chosen")
+	},
+	"after": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.after, "after", c.after, "new aspect: add @After advice")
+	},
+	"around": func(c *cli, fs *flag.FlagSet) {
+		fs.BoolVar(&c.around, "around", c.around, "new aspect: add @Around advice")
+	},
+	"custom": func(c *cli, fs *flag.FlagSet) {
+		fs.StringVar(&c.custom, "custom", c.custom, "new aspect: custom annotation of the aspect, e.g. Transactional")
+	},
+	"abstract": func(c *cli, fs *flag.FlagSet) {
+		fs.StringVar(&c.abstract, "abstract", c.abstract, "new proxy: interface returned by the factory, default I<Type>")
+	},
+	"pointcut": func(c *cli, fs *flag.FlagSet) {
+		fs.StringVar(&c.pointcut, "pointcut", c.pointcut, "new proxy: aspect advising the stub method")
+	},
+	"dir": func(c *cli, fs *flag.FlagSet) {
+		fs.StringVar(&c.dir, "dir", c.dir, "new: output directory, default aspect for aspects and . for proxies")
+	},
+}
+
+func newCLI(stdout, stderr io.Writer, opts ...Option) *cli {
+	return &cli{
+		stdout:    stdout,
+		stderr:    stderr,
+		opts:      opts,
+		recursive: true,
+		prune:     true,
+		useCache:  true,
+		interval:  DefaultWatchInterval,
+		debounce:  DefaultWatchDebounce,
+		format:    GraphDOT,
+		set:       map[string]bool{},
+	}
+}
+
+// flagSet defines the common flags and the flags of cmd, all flags if cmd is nil.
+func (c *cli) flagSet(cmd *command) *flag.FlagSet {
+	name := "aspect"
+	if cmd != nil {
+		name += " " + cmd.name
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.tags, "tags", c.tags, "comma-separated list of build tags to apply")
+	fs.BoolVar(&c.recursive, "recursive", c.recursive, "true or false package load recursively, default true")
+	fs.BoolVar(&c.recursive, "r", c.recursive, "true or false package load recursively, default true")
+	fs.StringVar(&c.deps, "deps", c.deps, "comma-separated list of dependencies need scan")
+	fs.StringVar(&c.config, "config", c.config, "config file path, default sandwich.yaml or sandwich.json in the module root")
+	fs.BoolVar(&c.json, "json", c.json, "print results as json")
+	if cmd == nil {
+		for _, define := range cliFlags {
+			define(c, fs)
+		}
+		return fs
+	}
+	for _, name := range cmd.flags {
+		cliFlags[name](c, fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: aspect %s [flags] %s\n\t%s\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses flags anywhere between the arguments, as in aspect explain main.Bar.Foo -json .
+func (c *cli) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		// -- ends flags
+		if n := len(args) - fs.NArg(); n > 0 && args[n-1] == "--" {
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	fs.Visit(func(f *flag.Flag) { c.set[f.Name] = true })
+	return positional, nil
+}
+
+func (c *cli) usage() {
+	fmt.Fprintf(c.stderr, "Usage of Aspect:\n")
+	fmt.Fprintf(c.stderr, "\taspect <command> [flags] [packages]\n")
+	fmt.Fprintf(c.stderr, "\taspect [flags] [packages] is aspect generate\n")
+	fmt.Fprintf(c.stderr, "Commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "\t%-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(c.stderr, "Run aspect help <command> for the flags of a command.\n")
+	fmt.Fprintf(c.stderr, "For more information, see:\n")
+	fmt.Fprintf(c.stderr, "\thttps://github.com/go-park/sandwich\n")
+}
+
+// run executes the command line args, without the program name, and returns the exit code.
+func (c *cli) run(args []string) int {
+	if len(args) > 0 && args[0] == "help" {
+		if len(args) > 1 {
+			if cmd := lookupCommand(args[1]); cmd != nil {
+				c.flagSet(cmd).Usage()
+				return ExitOK
+			}
+		}
+		c.usage()
+		return ExitOK
+	}
+	var (
+		cmd  *command
+		rest []string
+		err  error
+	)
+	if len(args) > 0 {
+		cmd = lookupCommand(args[0])
+	}
+	if cmd != nil {
+		rest, err = c.parse(c.flagSet(cmd), args[1:])
+	} else {
+		// aspect [flags] [packages], or flags before the command as in aspect -tags=sandwich clean .
+		fs := c.flagSet(nil)
+		fs.Usage = c.usage
+		rest, err = c.parse(fs, args)
+		cmd = lookupCommand("generate")
+		if len(rest) > 0 {
+			if sub := lookupCommand(rest[0]); sub != nil {
+				cmd, rest = sub, rest[1:]
+			}
+		}
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		return ExitUsage
+	}
+	code, err := cmd.run(c, rest)
+	if err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return ExitUsage
+	}
+	return code
+}
+
+// options returns options of the flags given, followed by options of the generator main.
+func (c *cli) options(patterns []string, extra ...Option) []Option {
+	configFile := c.config
+	if len(configFile) == 0 {
+		configFile = FindConfigFile(".")
+	}
+	// flags override values of config file
+	opts := []Option{
+		WithConfigFile(configFile),
+		WithPatterns(patterns...),
+		WithDeps(strings.Split(c.deps, ",")...),
+		WithTags(strings.Split(c.tags, ",")...),
+		WithCheck(c.check),
+		WithDiff(c.diff),
+		WithDryRun(c.dryRun),
+	}
+	if c.set["r"] || c.set["recursive"] {
+		opts = append(opts, WithRecursive(c.recursive))
+	}
+	if c.set["prune"] {
+		opts = append(opts, WithPrune(c.prune))
+	}
+	if c.set["cache"] {
+		opts = append(opts, WithCache(c.useCache))
+	}
+	opts = append(opts, extra...)
+	return append(opts, c.opts...)
+}
+
+// report prints diagnostics, stale and removed files of g, as json if requested.
+func (c *cli) report(g *Generator) (int, error) {
+	code := ExitOK
+	if g.Err() != nil || g.diagnostics.HasErrors() || len(g.Stale()) > 0 {
+		code = ExitFailure
+	}
+	if c.json {
+		var errMsg string
+		if err := g.Err(); err != nil {
+			errMsg = err.Error()
+		}
+		return code, c.printJSON(struct {
+			Written     []string              `json:"written"`
+			Stale       []string              `json:"stale"`
+			Removed     []string              `json:"removed"`
+			Diagnostics []astutils.Diagnostic `json:"diagnostics"`
+			Diffs       map[string]string     `json:"diffs,omitempty"`
+			Error       string                `json:"error,omitempty"`
+		}{
+			Written:     append([]string{}, g.Written()...),
+			Stale:       append([]string{}, g.Stale()...),
+			Removed:     append([]string{}, g.Removed()...),
+			Diagnostics: append([]astutils.Diagnostic{}, g.Diagnostics()...),
+			Diffs:       g.Diffs(),
+			Error:       errMsg,
+		})
+	}
+	if err := g.Err(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+	}
+	for _, name := range g.Stale() {
+		fmt.Fprint(c.stdout, g.Diffs()[name])
+	}
+	if c.dryRun {
+		for _, name := range g.Removed() {
+			fmt.Fprintln(c.stdout, name)
+		}
+	}
+	c.printDiagnostics(g)
+	if stale := g.Stale(); len(stale) > 0 && !g.diagnostics.HasErrors() {
+		log.Printf("%d generated file(s) out of date, run go generate", len(stale))
+	}
+	return code, nil
+}
+
+func (c *cli) printDiagnostics(g *Generator) {
+	for _, d := range g.Diagnostics() {
+		fmt.Fprintln(c.stderr, d)
+	}
+}
+
+func (c *cli) printJSON(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.stdout, string(data))
+	return err
+}
+
+func (c *cli) generate(args []string) (int, error) {
+	g := NewGenerator(c.options(args)...).ParsePackage().Generate().Format().Output()
+	return c.report(g)
+}
+
+func (c *cli) checkCmd(args []string) (int, error) {
+	g := NewGenerator(c.options(args, WithCheck(true))...).ParsePackage().Generate().Format().Output()
+	return c.report(g)
+}
+
+func (c *cli) clean(args []string) (int, error) {
+	g := NewGenerator(c.options(args)...).ParsePackage().Generate().Format().Clean()
+	return c.report(g)
+}
+
+func (c *cli) list(args []string) (int, error) {
+	g := NewGenerator(c.options(args)...).ParsePackage()
+	l := g.List()
+	if err := g.Err(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return ExitFailure, nil
+	}
+	if c.json {
+		if err := c.printJSON(l); err != nil {
+			return ExitFailure, err
+		}
+	} else {
+		fmt.Fprint(c.stdout, l)
+		c.printDiagnostics(g)
+	}
+	if g.diagnostics.HasErrors() {
+		return ExitFailure, nil
+	}
+	return ExitOK, nil
+}
+
+func (c *cli) graph(args []string) (int, error) {
+	format := c.format
+	if c.json {
+		format = GraphJSON
+	}
+	switch format {
+	case GraphDOT, GraphMermaid, GraphJSON:
+	default:
+		fmt.Fprintf(c.stderr, "unknown graph format %q, want dot, mermaid or json\n", format)
+		return ExitUsage, nil
+	}
+	g := NewGenerator(c.options(args)...).ParsePackage()
+	gr := g.Graph()
+	if err := g.Err(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return ExitFailure, nil
+	}
+	out, err := gr.Format(format)
+	if err != nil {
+		log.Print(err)
+		return ExitFailure, nil
+	}
+	fmt.Fprint(c.stdout, out)
+	return ExitOK, nil
+}
+
+func (c *cli) explain(args []string) (int, error) {
+	if len(args) == 0 {
+		c.flagSet(lookupCommand("explain")).Usage()
+		return ExitUsage, nil
+	}
+	g := NewGenerator(c.options(args[1:])...).ParsePackage()
+	e, err := g.Explain(args[0])
+	if err != nil {
+		log.Print(err)
+		return ExitFailure, nil
+	}
+	if c.json {
+		if err := c.printJSON(e); err != nil {
+			return ExitFailure, err
+		}
+	} else {
+		fmt.Fprint(c.stdout, e)
+		c.printDiagnostics(g)
+	}
+	if g.diagnostics.HasErrors() {
+		return ExitFailure, nil
+	}
+	return ExitOK, nil
+}
+
+func (c *cli) watch(args []string) (int, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var outErr error
+	report := func(g *Generator) {
+		if _, err := c.report(g); err != nil && outErr == nil {
+			outErr = err
+		}
+	}
+	// errors of runs are reported
+	if err := Watch(ctx, c.interval, c.debounce, report, c.options(args)...); err != nil {
+		return ExitFailure, outErr
+	}
+	return ExitOK, outErr
+}
+
+func (c *cli) newCmd(args []string) (int, error) {
+	if len(args) != 2 || (args[0] != "aspect" && args[0] != "proxy") {
+		c.flagSet(lookupCommand("new")).Usage()
+		return ExitUsage, nil
+	}
+	kind, name := args[0], args[1]
+	dir := c.dir
+	if len(dir) == 0 {
+		dir = "."
+		if kind == "aspect" {
+			dir = "aspect"
+		}
+	}
+	// annotations are written in the syntax of the project, comments if both are accepted
+	var syntax astutils.AnnotationSyntax
+	configFile := c.config
+	if len(configFile) == 0 {
+		configFile = FindConfigFile(".")
+	}
+	if len(configFile) > 0 {
+		if cfg, err := LoadConfig(configFile); err == nil {
+			syntax = astutils.AnnotationSyntax(cfg.Annotations)
+		}
+	}
+	var (
+		src []byte
+		err error
+	)
+	if kind == "aspect" {
+		src, err = ScaffoldAspect(AspectScaffold{
+			Package: scaffoldPackage(dir),
+			Name:    name,
+			Custom:  c.custom,
+			Before:  c.before,
+			After:   c.after,
+			Around:  c.around,
+			Syntax:  syntax,
+		})
+	} else {
+		src, err = ScaffoldProxy(ProxyScaffold{
+			Package:  scaffoldPackage(dir),
+			Type:     name,
+			Abstract: c.abstract,
+			Pointcut: c.pointcut,
+			Syntax:   syntax,
+		})
+	}
+	if err != nil {
+		log.Print(err)
+		return ExitFailure, nil
+	}
+	path := filepath.Join(dir, strings.ToLower(name)+".go")
+	if err := writeScaffold(path, src, c.force); err != nil {
+		log.Print(err)
+		return ExitFailure, nil
+	}
+	if c.json {
+		return ExitOK, c.printJSON(struct {
+			File string `json:"file"`
+		}{path})
+	}
+	fmt.Fprintf(c.stdout, "wrote %s\n", path)
+	return ExitOK, nil
+}
+
+// defaultConfig is written by aspect init.
+const defaultConfig = `# directory patterns are relative to this file, packages given on the command line to the current directory
+patterns: ["."]
+# directories skipped by package discovery, relative to this file, or any directory of that name without a slash
+ignore: []
+tags: [sandwich]
+deps: []
+recursive: true
+# default suffix of proxy struct and factory method
+suffix: Proxy
+# generated file name template, .Name and .Package of the proxied struct
+output: "{{ lower .Name }}_proxy.gen.go"
+# mirror generated files under this directory instead of next to the sources
+outputDir: ""
+# default factory mode when @Proxy omits singleton=
+singleton: false
+# default advice mode when @Aspect omits mode=, inline statements or call compiled aspects
+adviceMode: inline
+# registered extensions to enable, all if empty
+extensions: []
+# accepted annotation syntax, comment for @Proxy, directive for //sandwich:proxy or both
+annotations: both
+# proxy template file relative to this file, the default template if empty
+template: ""
+# remove orphaned generated files on output
+prune: true
+# skip proxies whose inputs are unchanged, cacheDir defaults to the user cache directory
+cache: true
+cacheDir: ""
+`
+
+func (c *cli) initConfig(args []string) (int, error) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	root := findModuleRoot(dir)
+	if len(root) == 0 {
+		log.Printf("%s is not in a module", dir)
+		return ExitFailure, nil
+	}
+	if existing := FindConfigFile(root); len(existing) > 0 && !c.force {
+		log.Printf("%s exists, use -force to overwrite it", existing)
+		return ExitFailure, nil
+	}
+	path := filepath.Join(root, ConfigFileNames[0])
+	if err := os.WriteFile(path, []byte(defaultConfig), 0o644); err != nil {
+		log.Print(err)
+		return ExitFailure, nil
+	}
+	if c.json {
+		return ExitOK, c.printJSON(struct {
+			Config string `json:"config"`
+		}{path})
+	}
+	fmt.Fprintf(c.stdout, "wrote %s\n", path)
+	return ExitOK, nil
+}
+
+func (c *cli) version(args []string) (int, error) {
+	if c.json {
+		return ExitOK, c.printJSON(struct {
+			Version string `json:"version"`
+			Go      string `json:"go"`
+		}{Version, runtime.Version()})
+	}
+	fmt.Fprintf(c.stdout, "aspect %s %s\n", Version, runtime.Version())
+	return ExitOK, nil
+}
+
+// Do runs the aspect command line, opts are applied after the flags.
+// Without a command, aspect [flags] [packages] generates as aspect generate does.
+func Do(opts ...Option) {
+	log.SetFlags(0)
+	log.SetPrefix("aspect: ")
+	if code := newCLI(os.Stdout, os.Stderr, opts...).run(os.Args[1:]); code != ExitOK {
+		os.Exit(code)
+	}
+}
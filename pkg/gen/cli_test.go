@@ -0,0 +1,97 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLI_run(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	c := newCLI(&stdout, &stderr)
+	assert.Equal(t, ExitOK, c.run([]string{"version", "-json"}))
+	assert.Contains(t, stdout.String(), `"version": "`+Version+`"`)
+
+	assert.Equal(t, ExitUsage, newCLI(&stdout, &stderr).run([]string{"list", "-format=dot"}))
+	assert.Contains(t, stderr.String(), "flag provided but not defined: -format")
+
+	// errors writing the output exit with a usage code instead of exiting the process
+	stderr.Reset()
+	assert.Equal(t, ExitUsage, newCLI(failingWriter{}, &stderr).run([]string{"version", "-json"}))
+	assert.Equal(t, "closed pipe\n", stderr.String())
+
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	stdout.Reset()
+	// flags before the command, as in aspect -tags=sandwich list .
+	c = newCLI(&stdout, &stderr, WithDir(dir), WithCache(false))
+	assert.Equal(t, ExitOK, c.run([]string{"-tags=sandwich", "list", "-json", "."}))
+	l := &Listing{}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), l))
+	if assert.Len(t, l.Proxies, 2) {
+		assert.Equal(t, "github.com/go-park/sandwich/examples.Bar", l.Proxies[0].Name)
+		assert.Equal(t, []string{"Bar", "Foo"}, l.Proxies[0].Methods)
+		assert.Equal(t, filepath.Join(dir, "bar_proxy.gen.go"), l.Proxies[0].Output)
+	}
+	assert.Len(t, l.Aspects, 3)
+
+	log := filepath.Join(dir, "aspect", "log.go")
+	src, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	src = bytes.Replace(src, []byte(`//@Aspect("log")`), []byte(`//@Aspect("log", mode="compiled")`), 1)
+	stdout.Reset()
+	stderr.Reset()
+	c = newCLI(&stdout, &stderr, WithDir(dir), WithCache(false), WithOverlay(map[string][]byte{log: src}))
+	assert.Equal(t, ExitFailure, c.run([]string{"-tags=sandwich", "explain", "main.Bar.Foo", "."}))
+	assert.Contains(t, stderr.String(), `unknown mode "compiled" of aspect AspectLog`)
+}
+
+func TestCLI_init(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/app\n"), 0o644))
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, ExitOK, newCLI(&stdout, &stderr).run([]string{"init", dir}))
+	cfg, err := LoadConfig(filepath.Join(dir, "sandwich.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sandwich"}, cfg.Tags)
+	assert.Equal(t, ExitFailure, newCLI(&stdout, &stderr).run([]string{"init", dir}))
+	assert.Equal(t, ExitOK, newCLI(&stdout, &stderr).run([]string{"init", "-force", dir}))
+}
+
+func TestCLI_json(t *testing.T) {
+	dir := copyExamples(t)
+	var stdout, stderr bytes.Buffer
+	run := func(args ...string) int {
+		stdout.Reset()
+		return newCLI(&stdout, &stderr, WithDir(dir), WithCache(false)).run(append([]string{"-tags=sandwich"}, args...))
+	}
+	assert.Equal(t, ExitOK, run("."))
+	orphan := filepath.Join(dir, "old_proxy.gen.go")
+	assert.NoError(t, os.WriteFile(orphan, []byte(astutils.GeneratedHeader+"\n\npackage main\n"), 0o644))
+
+	assert.Equal(t, ExitOK, run("clean", "-n", "-json", "."))
+	var report struct {
+		Removed []string          `json:"removed"`
+		Diffs   map[string]string `json:"diffs"`
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, []string{orphan}, report.Removed)
+	assert.FileExists(t, orphan)
+
+	assert.Equal(t, ExitFailure, run("check", "-diff", "-json", "."))
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Contains(t, report.Diffs[orphan], "-package main")
+
+	assert.Equal(t, ExitFailure, run("check", "-diff", "."))
+	assert.Contains(t, stdout.String(), "+++ "+os.DevNull)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("closed pipe") }
@@ -0,0 +1,222 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultOutputName is the template of generated file names.
+const DefaultOutputName = "{{ lower .Name }}_proxy.gen.go"
+
+// ConfigFileNames are looked up in the module root, in order.
+var ConfigFileNames = []string{"sandwich.yaml", "sandwich.yml", "sandwich.json"}
+
+// Config is the project configuration read from sandwich.yaml or sandwich.json.
+//
+//	patterns: ["./..."]
+//	ignore: [mocks, internal/legacy]
+//	tags: [sandwich]
+//	deps: [github.com/go-park/sandwich/examples/lib]
+//	recursive: true
+//	suffix: Proxy
+//	output: "{{ lower .Name }}_proxy.gen.go"
+//	outputDir: ""
+//	singleton: false
+//	adviceMode: inline
+//	extensions: [value]
+//	annotations: both
+//	template: ""
+//	prune: true
+//	cache: true
+//	cacheDir: ""
+type Config struct {
+	// Patterns are the packages to load, directory patterns are relative to the config file
+	Patterns []string `yaml:"patterns" json:"patterns"`
+	// Ignore skips directories when discovering packages, a glob of the path relative to
+	// the config file, or of the directory name if it has no slash
+	Ignore    []string `yaml:"ignore" json:"ignore"`
+	Tags      []string `yaml:"tags" json:"tags"`
+	Deps      []string `yaml:"deps" json:"deps"`
+	Recursive *bool    `yaml:"recursive" json:"recursive"`
+	// Suffix of proxy struct and factory method when @Proxy omits suffix=
+	Suffix string `yaml:"suffix" json:"suffix"`
+	// Output is the file name template, executed with .Name and .Package of the proxied struct
+	Output string `yaml:"output" json:"output"`
+	// OutputDir mirrors generated files under the directory instead of next to the sources,
+	// relative to the config file
+	OutputDir string `yaml:"outputDir" json:"outputDir"`
+	// Singleton is the factory mode when @Proxy omits singleton=
+	Singleton *bool `yaml:"singleton" json:"singleton"`
+	// AdviceMode is how advice is woven when @Aspect omits mode=, inline or call
+	AdviceMode string `yaml:"adviceMode" json:"adviceMode"`
+	// Extensions enabled by name, all registered extensions are enabled if empty
+	Extensions []string `yaml:"extensions" json:"extensions"`
+	// Annotations is the accepted syntax, comment for @Proxy, directive for //sandwich:proxy or both
+	Annotations string `yaml:"annotations" json:"annotations"`
+	// Template is the proxy template file, relative to the config file
+	Template string `yaml:"template" json:"template"`
+	// Prune removes orphaned generated files on output, default true
+	Prune *bool `yaml:"prune" json:"prune"`
+	// Cache skips proxies whose inputs are unchanged, default true
+	Cache *bool `yaml:"cache" json:"cache"`
+	// CacheDir overrides the user cache directory
+	CacheDir string `yaml:"cacheDir" json:"cacheDir"`
+}
+
+// LoadConfig reads a yaml or json config file, chosen by extension.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, cfg)
+	} else {
+		err = yaml.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := astutils.AnnotationSyntax(cfg.Annotations).Validate(); err != nil {
+		return nil, fmt.Errorf("%s: annotations: %w", path, err)
+	}
+	// paths are relative to the config file, not to the directory aspect runs in
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range cfg.Patterns {
+		root, expand := strings.CutSuffix(filepath.ToSlash(v), "/...")
+		if root == "..." {
+			root, expand = ".", true
+		}
+		if !isDirPattern(root) || filepath.IsAbs(root) {
+			continue
+		}
+		cfg.Patterns[i] = filepath.Join(dir, root)
+		if expand {
+			cfg.Patterns[i] += string(filepath.Separator) + "..."
+		}
+	}
+	for i, v := range cfg.Ignore {
+		if strings.Contains(filepath.ToSlash(v), "/") && !filepath.IsAbs(v) {
+			cfg.Ignore[i] = filepath.Join(dir, v)
+		}
+	}
+	if len(cfg.Template) > 0 && !filepath.IsAbs(cfg.Template) {
+		cfg.Template = filepath.Join(dir, cfg.Template)
+	}
+	if len(cfg.OutputDir) > 0 && !filepath.IsAbs(cfg.OutputDir) {
+		cfg.OutputDir = filepath.Join(dir, cfg.OutputDir)
+	}
+	if len(cfg.Output) > 0 {
+		if _, err := parseOutputName(cfg.Output); err != nil {
+			return nil, fmt.Errorf("%s: output: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// FindConfigFile returns the config file of the module containing dir, or "" if there is none.
+func FindConfigFile(dir string) string {
+	root := findModuleRoot(dir)
+	if len(root) == 0 {
+		return ""
+	}
+	for _, name := range ConfigFileNames {
+		path := filepath.Join(root, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+func findModuleRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if info, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func (c *Config) apply(o *options) {
+	WithPatterns(c.Patterns...).apply(o)
+	WithIgnore(c.Ignore...).apply(o)
+	WithTags(c.Tags...).apply(o)
+	WithDeps(c.Deps...).apply(o)
+	if c.Recursive != nil {
+		o.recursive = *c.Recursive
+	}
+	if len(c.Suffix) > 0 {
+		o.suffix = c.Suffix
+	}
+	if len(c.Output) > 0 {
+		o.outputName = c.Output
+	}
+	if len(c.OutputDir) > 0 {
+		o.outputDir = c.OutputDir
+	}
+	if c.Singleton != nil {
+		o.singleton = *c.Singleton
+	}
+	WithAdviceMode(aspect.AdviceMode(c.AdviceMode)).apply(o)
+	if len(c.Extensions) > 0 {
+		o.extensions = c.Extensions
+	}
+	if len(c.Annotations) > 0 {
+		o.syntax = astutils.AnnotationSyntax(c.Annotations)
+	}
+	if len(c.Template) > 0 {
+		o.templateFile = c.Template
+	}
+	if c.Prune != nil {
+		o.prune = *c.Prune
+	}
+	if c.Cache != nil {
+		o.useCache = *c.Cache
+	}
+	if len(c.CacheDir) > 0 {
+		o.cacheDir = c.CacheDir
+	}
+}
+
+func parseOutputName(text string) (*template.Template, error) {
+	return template.New("output").Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}).Parse(text)
+}
+
+// outputFileName executes the output name template for the proxied struct name.
+func outputFileName(text, pkgName, name string) (string, error) {
+	tpl, err := parseOutputName(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, struct{ Name, Package string }{name, pkgName})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
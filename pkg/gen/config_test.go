@@ -0,0 +1,76 @@
+package gen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "sandwich.yaml"), []byte(`
+tags: [sandwich]
+recursive: false
+suffix: Aop
+output: "{{ .Name }}.gen.go"
+singleton: true
+adviceMode: call
+annotations: directive
+`), 0o644))
+	sub := filepath.Join(dir, "sub")
+	assert.NoError(t, os.Mkdir(sub, 0o755))
+
+	path := FindConfigFile(sub)
+	assert.Equal(t, filepath.Join(dir, "sandwich.yaml"), path)
+
+	g := NewGenerator(WithConfigFile(path), WithTags("dev"))
+	assert.NoError(t, g.configErr)
+	assert.Equal(t, []string{"dev"}, g.tags)
+	assert.False(t, g.recursive)
+	assert.Equal(t, "Aop", g.suffix)
+	assert.True(t, g.singleton)
+	assert.Equal(t, aspect.ModeCall, g.adviceMode)
+	assert.Equal(t, astutils.SyntaxDirective, g.syntax)
+
+	name, err := outputFileName(g.outputName, "main", "Foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Foo.gen.go", name)
+	name, err = outputFileName(DefaultOutputName, "main", "Foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo_proxy.gen.go", name)
+
+	paths := filepath.Join(dir, "sub", "paths.yaml")
+	assert.NoError(t, os.WriteFile(paths, []byte("outputDir: gen\ntemplate: proxy.tmpl\n"), 0o644))
+	g = NewGenerator(WithSingleton(true), WithConfigFile(paths))
+	assert.NoError(t, g.configErr)
+	assert.True(t, g.singleton)
+	assert.Equal(t, filepath.Join(sub, "gen"), g.outputDir)
+	assert.Equal(t, filepath.Join(sub, "proxy.tmpl"), g.templateFile)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	assert.NoError(t, os.WriteFile(invalid, []byte("annotations: javadoc\n"), 0o644))
+	_, err = LoadConfig(invalid)
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_patterns(t *testing.T) {
+	dir := copyExamples(t)
+	config := filepath.Join(dir, "sandwich.yaml")
+	assert.NoError(t, os.WriteFile(config, []byte("patterns: [., ./lib/..., fmt]\ntags: [sandwich]\nrecursive: false\n"), 0o644))
+	cfg, err := LoadConfig(config)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dir, filepath.Join(dir, "lib", "..."), "fmt"}, cfg.Patterns)
+
+	// run from another directory, patterns are relative to the config file
+	g := NewGenerator(WithDir(filepath.Join(dir, "aspect")), WithConfigFile(config), WithCache(false)).ParsePackage()
+	assert.NoError(t, g.Err())
+	l := g.List()
+	if assert.Len(t, l.Proxies, 2) {
+		assert.Equal(t, filepath.Join(dir, "bar_proxy.gen.go"), l.Proxies[0].Output)
+	}
+}
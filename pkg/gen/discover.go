@@ -0,0 +1,198 @@
+package gen
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// discoverPatterns expands directory patterns into the package directories below them, as ./dir
+// relative to dir. A pattern ending in /... is expanded, others only if recursive is set.
+// Expansion skips testdata, vendor, hidden and _ directories, directories matching ignore,
+// and nested modules unless they are used by the go.work workspace of dir.
+// Import paths are loaded as they are.
+func discoverPatterns(dir string, patterns, ignore []string, recursive bool) []string {
+	d := &discoverer{
+		dir:       absPath(dir),
+		ignore:    ignore,
+		workspace: map[string]struct{}{},
+		seen:      map[string]struct{}{},
+	}
+	for _, use := range workspaceModules(d.dir) {
+		d.workspace[use] = struct{}{}
+	}
+	var list []string
+	for _, v := range patterns {
+		root, expand := strings.CutSuffix(filepath.ToSlash(v), "/...")
+		if root == "..." {
+			root, expand = ".", true
+		}
+		if !isDirPattern(root) {
+			list = append(list, v)
+			continue
+		}
+		if !expand && !recursive {
+			list = append(list, v)
+			continue
+		}
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(d.dir, root)
+		}
+		list = append(list, d.walk(filepath.Clean(root))...)
+	}
+	return list
+}
+
+type discoverer struct {
+	dir       string
+	ignore    []string
+	workspace map[string]struct{} // module directories of go.work
+	seen      map[string]struct{}
+}
+
+func (d *discoverer) walk(root string) []string {
+	var list []string
+	_ = filepath.WalkDir(root, func(name string, e fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("discover: %s", err)
+			return nil
+		}
+		if !e.IsDir() {
+			return nil
+		}
+		if name != root && d.skip(name) {
+			return filepath.SkipDir
+		}
+		if d.ignored(name) {
+			return filepath.SkipDir
+		}
+		if _, ok := d.seen[name]; ok || !hasGoFiles(name) {
+			return nil
+		}
+		d.seen[name] = struct{}{}
+		list = append(list, d.pattern(name))
+		return nil
+	})
+	return list
+}
+
+// skip reports directories the go command ignores in ./... and nested modules.
+func (d *discoverer) skip(name string) bool {
+	base := filepath.Base(name)
+	if base == "testdata" || base == "vendor" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_") {
+		return true
+	}
+	if _, ok := d.workspace[name]; ok {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(name, "go.mod"))
+	return err == nil && !info.IsDir()
+}
+
+// ignored matches name against the ignore list, an entry matches the path relative to dir,
+// the absolute path if it is absolute, or any directory of that name if it has no slash.
+func (d *discoverer) ignored(name string) bool {
+	rel, err := filepath.Rel(d.dir, name)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, v := range d.ignore {
+		target := rel
+		if filepath.IsAbs(v) {
+			target = filepath.ToSlash(name)
+		}
+		v = strings.TrimPrefix(path.Clean(filepath.ToSlash(v)), "./")
+		if ok, _ := path.Match(v, target); ok {
+			return true
+		}
+		if !strings.Contains(v, "/") {
+			if ok, _ := path.Match(v, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *discoverer) pattern(name string) string {
+	rel, err := filepath.Rel(d.dir, name)
+	if err != nil {
+		return name
+	}
+	if rel == "." || strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return "." + string(filepath.Separator) + rel
+}
+
+// isDirPattern reports whether p names a directory rather than an import path.
+func isDirPattern(p string) bool {
+	return p == "." || p == ".." || strings.HasPrefix(p, "./") || strings.HasPrefix(p, "../") || filepath.IsAbs(p)
+}
+
+func hasGoFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".go") && !strings.HasSuffix(e.Name(), "_test.go") {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceModules returns the module directories used by the go.work file of dir,
+// located as the go command does, GOWORK=off disables workspaces.
+func workspaceModules(dir string) []string {
+	work := os.Getenv("GOWORK")
+	switch work {
+	case "off":
+		return nil
+	case "":
+		work = findWorkFile(dir)
+	}
+	if len(work) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(work)
+	if err != nil {
+		log.Printf("discover: %s", err)
+		return nil
+	}
+	wf, err := modfile.ParseWork(work, data, nil)
+	if err != nil {
+		log.Printf("discover: %s", err)
+		return nil
+	}
+	var list []string
+	for _, use := range wf.Use {
+		p := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(filepath.Dir(work), p)
+		}
+		list = append(list, filepath.Clean(p))
+	}
+	return list
+}
+
+func findWorkFile(dir string) string {
+	for {
+		name := filepath.Join(dir, "go.work")
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			return name
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
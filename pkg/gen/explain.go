@@ -0,0 +1,170 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+// How a pointcut name was resolved to an aspect.
+const (
+	ResolvedByAlias    = "alias"
+	ResolvedByCustom   = "custom annotation"
+	ResolvedByFullName = "full name"
+	Unresolved         = "unresolved"
+)
+
+type (
+	// Explanation tells which advice is woven into a proxied method, and in which order.
+	Explanation struct {
+		Proxy     string              `json:"proxy"` // package path and name of the proxied struct
+		Method    string              `json:"method"`
+		Pos       token.Position      `json:"pos"`
+		Pointcuts []ExplainedPointcut `json:"pointcuts"`
+		Steps     []AdviceStep        `json:"steps"`
+	}
+	ExplainedPointcut struct {
+		Name       string         `json:"name"`
+		Level      string         `json:"level"` // struct or method
+		Resolution string         `json:"resolution"`
+		Aspect     string         `json:"aspect,omitempty"` // full name of the resolved aspect
+		Pos        token.Position `json:"pos"`
+	}
+)
+
+// Explain weaves the method named by target, <pkg>.<Type>.<Method>, without generating anything.
+// pkg is the package name or import path and may be omitted if the type is unique.
+func (g *Generator) Explain(target string) (*Explanation, error) {
+	g.inspect()
+	if g.err != nil {
+		return nil, g.err
+	}
+	items := strings.Split(target, ".")
+	if len(items) < 2 {
+		return nil, fmt.Errorf("invalid target %q, want <pkg>.<Type>.<Method>", target)
+	}
+	pkgName := strings.Join(items[:len(items)-2], ".")
+	typeName, methodName := items[len(items)-2], items[len(items)-1]
+	var (
+		proxies []aspect.Proxy
+		ident   *ast.Ident
+	)
+	for k, p := range g.proxyCache {
+		if p.Name() != typeName {
+			continue
+		}
+		if len(pkgName) == 0 || p.PkgName() == pkgName || p.PkgPath() == pkgName {
+			proxies = append(proxies, p)
+			ident = k
+		}
+	}
+	switch len(proxies) {
+	case 0:
+		return nil, fmt.Errorf("no proxy %s found", strings.Join(items[:len(items)-1], "."))
+	case 1:
+	default:
+		return nil, fmt.Errorf("%s is ambiguous, qualify it with the package path", target)
+	}
+	proxy := proxies[0]
+	var method aspect.Method
+	for _, m := range proxy.GetMethods() {
+		if m.Name() == methodName {
+			method = m
+		}
+	}
+	if method == nil {
+		if pkg, ok := g.pkgList[proxy.PkgPath()]; ok && pkg.AstPkg.TypesInfo != nil {
+			if obj := pkg.AstPkg.TypesInfo.Defs[ident]; obj != nil {
+				if m, _, _ := types.LookupFieldOrMethod(types.NewPointer(obj.Type()), true, obj.Pkg(), methodName); m != nil {
+					return nil, fmt.Errorf("%s.%s has no pointcut, the proxy delegates it to %s", typeName, methodName, typeName)
+				}
+			}
+		}
+		return nil, fmt.Errorf("%s has no method %s", typeName, methodName)
+	}
+	e := &Explanation{
+		Proxy:  proxy.PkgPath() + "." + proxy.Name(),
+		Method: methodName,
+	}
+	if method.Func() != nil {
+		e.Pos = g.fset.Position(method.Func().Pos())
+	}
+	structCuts := len(proxy.GetPointcuts())
+	cuts := methodPointcuts(proxy, method)
+	for i, cut := range cuts {
+		// empty names and system annotations are no pointcuts and ignored by weaving
+		if len(cut.Name()) == 0 || astutils.IsSystemAnnotation(astutils.Annotation(cut.Name())) {
+			continue
+		}
+		ec := ExplainedPointcut{
+			Name:  cut.Name(),
+			Level: "method",
+			Pos:   g.fset.Position(cut.Pos()),
+		}
+		if i < structCuts {
+			ec.Level = "struct"
+		}
+		ec.Aspect, ec.Resolution = g.aspectName(cut.Name())
+		if _, ok := g.aspectCache[ec.Aspect]; !ok {
+			ec.Aspect, ec.Resolution = "", Unresolved
+		}
+		e.Pointcuts = append(e.Pointcuts, ec)
+	}
+	_, _, e.Steps = g.weaveMethod(cuts, method)
+	return e, nil
+}
+
+func (e *Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s.%s %s\n", e.Proxy, e.Method, relPosition(e.Pos))
+	fmt.Fprintf(&b, "pointcuts:\n")
+	for _, v := range e.Pointcuts {
+		if v.Resolution == Unresolved {
+			fmt.Fprintf(&b, "  %s (%s) unresolved %s\n", v.Name, v.Level, relPosition(v.Pos))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s (%s) -> %s by %s %s\n", v.Name, v.Level, v.Aspect, v.Resolution, relPosition(v.Pos))
+	}
+	fmt.Fprintf(&b, "chain:\n")
+	for i, v := range e.Steps {
+		if v.Kind == "proceed" {
+			fmt.Fprintf(&b, "  %d. proceed\n", i+1)
+		} else {
+			kind := v.Kind
+			if len(v.Mode) > 0 {
+				kind += " (" + v.Mode + ")"
+			}
+			fmt.Fprintf(&b, "  %d. %s %s %s\n", i+1, kind, v.Aspect, relPosition(v.Pos))
+		}
+		for _, stmt := range v.Stmts {
+			fmt.Fprintf(&b, "       %s\n", strings.ReplaceAll(stmt, "\n", "\n       "))
+		}
+	}
+	return b.String()
+}
+
+// relPosition prints pos relative to the working directory when possible.
+func relPosition(pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	pos.Filename = relPath(pos.Filename)
+	return pos.String()
+}
+
+// relPath returns name relative to the working directory when it is below it.
+func relPath(name string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return name
+}
@@ -2,16 +2,21 @@ package gen
 
 import (
 	"bytes"
-	"flag"
 	"fmt"
 	"go/ast"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/go-park/sandwich/pkg/aspect"
 	"github.com/go-park/sandwich/pkg/astutils"
@@ -30,9 +35,29 @@ type Generator struct {
 	proxyCache        map[*ast.Ident]aspect.Proxy
 	delayAspectLoader map[astutils.Annotation][]func()
 	componentCache    map[string]aspect.Component
+	stale             []string
+	diffs             map[string]string // unified diffs of stale files
+	written           []string
+	removed           []string
+	fset              *token.FileSet
+	diagnostics       *astutils.Diagnostics
+	cache             *genCache
+	cachePending      map[string][2]string // output name to cache id and key, stored once written
+	inspected         bool
+	parsed            bool                           // patterns are discovered, loaded once inspected
+	incremental       bool                           // skip loading unchanged packages, set by Generate
+	loaded            []*packages.Package            // root packages, whose errors are reported once inspected
+	skipped           map[string]pkgEntry            // unchanged packages not loaded, by directory
+	inputs            map[string]map[string]struct{} // files proxies depend on, by package path
+	volatile          map[string]bool                // packages whose proxies refer to missing aspects or components
+	err               error                          // the first error which stopped the pipeline
+	exts              []astutils.Extension           // enabled extensions
+	templates         map[string]*proxyTemplate      // by path, empty for the default template
+	emitted           map[string][]byte              // files emitted by plugins, by target path
 }
 
 func NewGenerator(opts ...Option) *Generator {
+	fset := token.NewFileSet()
 	ge := &Generator{
 		options:           DefaultOptions(),
 		pkgList:           map[string]*astutils.Package{},
@@ -42,34 +67,98 @@ func NewGenerator(opts ...Option) *Generator {
 		proxyCache:        map[*ast.Ident]aspect.Proxy{},
 		delayAspectLoader: map[astutils.Annotation][]func(){},
 		componentCache:    map[string]aspect.Component{},
+		fset:              fset,
+		diagnostics:       astutils.NewDiagnostics(fset),
+		cachePending:      map[string][2]string{},
+		skipped:           map[string]pkgEntry{},
+		inputs:            map[string]map[string]struct{}{},
+		volatile:          map[string]bool{},
+		templates:         map[string]*proxyTemplate{},
+		emitted:           map[string][]byte{},
+		diffs:             map[string]string{},
 	}
 	for _, opt := range opts {
 		opt.apply(&ge.options)
 	}
+	ge.cache = newCache()
+	if ge.useCache {
+		ge.cache = loadCache(ge.cacheDir, findModuleRoot(ge.dir))
+	}
+	ge.cache.overlay = ge.overlay
 	return ge
 }
 
-// parsePackage recursive analyzes the package constructed from the patterns and tags.
-// parsePackage exits if there is an error.
+// ParsePackage validates the options and discovers the packages of the patterns and tags,
+// which are loaded once inspected. An invalid option stops the pipeline, see Err.
 func (g *Generator) ParsePackage() *Generator {
+	if g.configErr != nil {
+		return g.fail("loading config: %w", g.configErr)
+	}
+	exts, err := astutils.LookupExtensions(g.extensions...)
+	if err != nil {
+		return g.fail("loading config: %w", err)
+	}
+	g.exts = exts
+	if err := g.syntax.Validate(); err != nil {
+		return g.fail("loading config: %w", err)
+	}
+	if g.adviceMode != aspect.ModeInline && g.adviceMode != aspect.ModeCall {
+		return g.fail("loading config: unknown advice mode %q, want inline or call", g.adviceMode)
+	}
+	if _, err := parseOutputName(g.outputName); err != nil {
+		return g.fail("loading config: output: %w", err)
+	}
+	g.patterns = discoverPatterns(g.dir, g.patterns, g.ignore, g.recursive)
+	g.parsed = true
+	return g
+}
+
+// fail records the first error which stops the pipeline, later stages do nothing.
+func (g *Generator) fail(format string, args ...any) *Generator {
+	if g.err == nil {
+		g.err = fmt.Errorf(format, args...)
+	}
+	return g
+}
+
+// Err returns the error which stopped the pipeline: an invalid option, packages failed
+// to load or files failed to write. Errors of the sources are Diagnostics.
+func (g *Generator) Err() error {
+	return g.err
+}
+
+// load type checks the packages of the patterns, except unchanged ones in incremental mode.
+func (g *Generator) load() {
+	if !g.parsed || g.err != nil {
+		return
+	}
+	patterns := g.patterns
+	if g.incremental {
+		if patterns = g.skipUnchanged(patterns); len(patterns) == 0 {
+			return
+		}
+	}
 	cfg := &packages.Config{
 		Mode: packages.NeedName |
+			packages.NeedTypes |
 			packages.NeedTypesInfo |
 			packages.NeedSyntax |
 			packages.NeedDeps |
 			packages.NeedImports |
 			packages.NeedFiles |
-			packages.NeedCompiledGoFiles,
+			packages.NeedCompiledGoFiles |
+			packages.NeedModule,
+		Fset:       g.fset,
+		Dir:        g.dir,
+		Overlay:    g.overlay,
 		Tests:      false,
 		BuildFlags: []string{fmt.Sprintf("-tags=%s", strings.Join(g.tags, " "))},
 		Logf:       log.Printf,
 	}
-	if g.recursive {
-		g.patterns = getAllPathPatterns(g.patterns)
-	}
-	pkgList, err := packages.Load(cfg, g.patterns...)
+	pkgList, err := packages.Load(cfg, patterns...)
 	if err != nil {
-		log.Fatal(err)
+		g.fail("loading packages: %w", err)
+		return
 	}
 	var depPkgList []*packages.Package
 	for _, dep := range g.deps {
@@ -81,29 +170,37 @@ func (g *Generator) ParsePackage() *Generator {
 			}
 		}
 	}
-	log.Printf("package patterns is %v, load result is %v, dep result is %v", g.patterns, pkgList, depPkgList)
+	log.Printf("package patterns is %v, load result is %v, dep result is %v", patterns, pkgList, depPkgList)
+	g.loaded = append(g.loaded, pkgList...)
 	g.addPackage(append(pkgList, depPkgList...)...)
-	return g
 }
 
 // addPackage adds a type checked Package and its syntax files to the generator.
 func (g *Generator) addPackage(list ...*packages.Package) {
+	pwd := getCurrentPkg(g.dir)
 	for _, pkg := range list {
 		item := &astutils.Package{
 			Name:              pkg.Name,
 			Path:              pkg.ID,
-			Pwd:               getCurrentPkg(),
+			Pwd:               pwd,
+			Dir:               g.dir,
 			AstPkg:            pkg,
 			Defs:              map[*ast.Ident]types.Object{},
 			Files:             make([]*astutils.File, len(pkg.Syntax)),
 			OutputFiles:       map[string][]byte{},
 			FileBuf:           map[string]bytes.Buffer{},
+			Unchanged:         map[string]struct{}{},
 			AspectCache:       g.aspectCache,
 			AspectAlias:       g.aspectAlias,
 			AspectCustoms:     g.aspectCustoms,
 			ProxyCache:        g.proxyCache,
 			DelayAspectLoader: g.delayAspectLoader,
 			ComponentCache:    g.componentCache,
+			Diagnostics:       g.diagnostics,
+			ProxySuffix:       g.suffix,
+			Singleton:         g.singleton,
+			Extensions:        g.exts,
+			Syntax:            g.syntax,
 		}
 		for i, file := range pkg.Syntax {
 			item.Files[i] = &astutils.File{
@@ -116,8 +213,99 @@ func (g *Generator) addPackage(list ...*packages.Package) {
 	}
 }
 
-// Generate inspect node and construct proxy data
-func (g *Generator) Generate() *Generator {
+// reportLoadErrors reports the errors of loading root packages. Type errors in generated files and
+// references to declarations of the files being generated are left out, as they are expected
+// before the proxies are written.
+func (g *Generator) reportLoadErrors() {
+	generated := map[string]struct{}{}
+	declare := func(src []byte) {
+		f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+		if err != nil {
+			return
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					generated[decl.Name.Name] = struct{}{}
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						generated[spec.Name.Name] = struct{}{}
+					case *ast.ValueSpec:
+						for _, v := range spec.Names {
+							generated[v.Name] = struct{}{}
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, pkg := range g.pkgList {
+		for _, v := range pkg.FileBuf {
+			declare(v.Bytes())
+		}
+	}
+	for _, v := range g.emitted {
+		declare(v)
+	}
+	for _, pkg := range g.loaded {
+		generatedFiles := map[string]struct{}{}
+		for _, f := range pkg.Syntax {
+			if ast.IsGenerated(f) {
+				generatedFiles[g.fset.Position(f.Package).Filename] = struct{}{}
+			}
+		}
+		for _, e := range pkg.Errors {
+			pos := errorPosition(e.Pos)
+			if e.Kind == packages.TypeError {
+				if _, ok := generatedFiles[pos.Filename]; ok {
+					continue
+				}
+				name := strings.TrimPrefix(e.Msg, "undefined: ")
+				if _, ok := generated[name[strings.LastIndex(name, ".")+1:]]; ok && name != e.Msg {
+					continue
+				}
+			}
+			g.diagnostics.ErrorAt(pos, astutils.CodeInvalidPackage, "%s", e.Msg)
+		}
+	}
+}
+
+// errorPosition parses the file:line:col position of a package error, line and col are optional.
+func errorPosition(pos string) token.Position {
+	var nums []int
+	for len(nums) < 2 {
+		i := strings.LastIndex(pos, ":")
+		if i < 0 {
+			break
+		}
+		n, err := strconv.Atoi(pos[i+1:])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		pos = pos[:i]
+	}
+	p := token.Position{Filename: strings.TrimPrefix(pos, "-")}
+	if len(nums) > 0 {
+		p.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		p.Column = nums[1]
+	}
+	return p
+}
+
+// inspect collects proxies, aspects and components of all packages, once.
+func (g *Generator) inspect() {
+	if g.inspected {
+		return
+	}
+	g.inspected = true
+	g.load()
 	for _, pkg := range g.pkgList {
 		for _, file := range pkg.Files {
 			if file.File != nil {
@@ -137,34 +325,71 @@ func (g *Generator) Generate() *Generator {
 			load()
 		}
 	}
+	g.afterParse()
+}
 
+// Generate inspect node and construct proxy data
+func (g *Generator) Generate() *Generator {
+	if !g.inspected {
+		g.incremental = g.cacheable()
+	}
+	g.inspect()
 	for k, proxy := range g.proxyCache {
 		if !k.IsExported() {
-			log.Panic("unexported struct cannot be proxy")
+			g.diagnostics.Errorf(k.Pos(), astutils.CodeUnexportedProxy,
+				"unexported struct %s cannot be proxy", k.Name)
+			continue
+		}
+		pkg := g.pkgList[proxy.PkgPath()]
+		var cacheID, cacheKey, outputName string
+		diagnostics := g.diagnostics.Len()
+		// plugins may depend on anything, proxies are rendered every time
+		if targetDir, ok := g.targetDir(pkg); ok && g.useCache && len(g.activePlugins()) == 0 {
+			cacheID = proxy.PkgPath() + "." + proxy.Name()
+			cacheKey = g.proxyKey(k, proxy)
+			outputName = g.outputPath(pkg, targetDir, proxy.Name())
+			if data, ok := g.cache.lookup(cacheID, cacheKey, outputName); ok {
+				pkg.FileBuf[proxy.Name()] = *bytes.NewBuffer(data)
+				pkg.Unchanged[proxy.Name()] = struct{}{}
+				continue
+			}
+		}
+		typeArgs := astutils.TypeParamNames(proxy.TypeParams())
+		if len(typeArgs) > 0 && proxy.IsSingleton() {
+			g.diagnostics.Errorf(k.Pos(), astutils.CodeInvalidProxy,
+				"generic struct %s cannot be singleton proxy", k.Name)
+			continue
 		}
 		abstract := proxy.Abstract()
 		if len(abstract) == 0 {
 			// parent = proxy.Name()
-			abstract = "*" + proxy.Name() + proxy.Suffix()
+			abstract = "*" + proxy.Name() + proxy.Suffix() + typeArgs
+		} else if len(typeArgs) > 0 && !strings.Contains(abstract, "[") && isGenericType(pkg, abstract) {
+			// @Proxy("IRepo") of Repo[T] returns IRepo[T]
+			abstract += typeArgs
 		}
 		pd := astutils.ProxyData{
+			Version:         astutils.ProxyDataVersion,
 			Package:         proxy.PkgName(),
+			PkgPath:         proxy.PkgPath(),
 			ProxyStructName: proxy.Name() + proxy.Suffix(),
 			AbstractName:    abstract,
 			ParentName:      proxy.Name(),
 			Option:          proxy.Option(),
 			Singleton:       proxy.IsSingleton(),
+			TypeParams:      template.HTML(astutils.TypeParamsDecl(proxy.TypeParams())),
+			TypeArgs:        template.HTML(typeArgs),
 		}
 		pd.Imports = append(pd.Imports, astutils.GetImports(proxy.Imports())...)
 		for _, v := range proxy.Fields() {
-			comp, ok := g.componentCache[v.Inject()]
+			comp, instance, ok := g.lookupComponent(v.Inject())
 			if !(ok || len(v.Assign()) > 0) {
 				continue
 			}
 			var assign string
 			if ok {
 				facPkg, facPkgName, facName := comp.Factory()
-				assign = facName + "()"
+				assign = facName + instance + "()"
 				if facPkg != proxy.PkgPath() {
 					assign = facPkgName + "." + assign
 				}
@@ -178,153 +403,771 @@ func (g *Generator) Generate() *Generator {
 					Val: template.HTML(assign),
 				})
 		}
-		cuts := proxy.GetPointcuts()
+		called := map[string]aspect.Aspect{}
 		for _, method := range proxy.GetMethods() {
-			cuts := append(cuts, method.GetPointcuts()...)
-			paramNames, params := method.GetParams()
-			resultNames, results := method.GetResults()
-			m := &astutils.ProxyMethod{
-				Name:        method.Name(),
-				Params:      strings.Join(params, ", "),
-				ParamNames:  strings.Join(paramNames, ", "),
-				Results:     strings.Join(results, ", "),
-				ResultNames: strings.Join(resultNames, ", "),
-			}
-			var postStack [][]string
-			for _, cut := range cuts {
-				aspectName := cut.Name()
-				if alias, ok := g.aspectAlias[aspectName]; ok {
-					aspectName = alias
-				} else if anno, ok := g.aspectCustoms[astutils.Annotation(aspectName)]; ok {
-					aspectName = anno
-				}
-
-				aspect, ok := g.aspectCache[aspectName]
-				if !ok {
-					continue
-				}
-				pd.Imports = append(pd.Imports, astutils.GetImports(aspect.Imports())...)
-				before := astutils.ParseAdviceStmt(aspect.GetBefore(), method)
-				after := astutils.ParseAdviceStmt(aspect.GetAfter(), method)
-				aroundBefore, aroundAfter := astutils.ParseAroundAdvice(aspect.GetAround(), method)
-				postStack = append(postStack, after, aroundAfter)
-				for _, v := range append(aroundBefore, before...) {
-					if strings.HasPrefix(v, "-") {
-						continue
-					}
-					m.Before = append(m.Before, template.HTML(v))
-				}
-			}
-			// invoke method of proxy
-			args, _ := method.GetParams()
-			proceedStmt := fmt.Sprintf("p.parent.%s(%s)", method.Name(), strings.Join(args, ", "))
-			rets, _ := method.GetResults()
-			if len(rets) > 0 {
-				proceedStmt = fmt.Sprintf("%s = %s", strings.Join(rets, ", "), proceedStmt)
-			}
-			postStack = append(postStack, []string{proceedStmt})
-			// reverse after/around advice
-			for len(postStack) > 0 {
-				n := len(postStack) - 1
-				for _, v := range postStack[n] {
-					if strings.HasPrefix(v, "-") {
-						continue
-					}
-					m.After = append(m.After, template.HTML(v))
+			m, imports, steps := g.weaveMethod(methodPointcuts(proxy, method), method)
+			g.pluginMethod(proxy, method, m)
+			pd.Imports = append(pd.Imports, imports...)
+			pd.Methods = append(pd.Methods, m)
+			for _, s := range steps {
+				if s.called != nil {
+					g.addAspectField(&pd, proxy, s.called, called)
 				}
-				postStack = postStack[:n]
 			}
-			pd.Methods = append(pd.Methods, m)
 		}
-		tpl, err := template.New("").Parse(astutils.GetProxyTpl())
+		// delegate the rest of parent methods
+		advised := map[string]struct{}{}
+		for _, m := range pd.Methods {
+			advised[m.Name] = struct{}{}
+		}
+		var parentObj types.Object
+		if pkg, ok := g.pkgList[proxy.PkgPath()]; ok && pkg.AstPkg.TypesInfo != nil {
+			parentObj = pkg.AstPkg.TypesInfo.Defs[k]
+		}
+		delegates, imports := astutils.GetDelegateMethods(parentObj, advised)
+		pd.Methods = append(pd.Methods, delegates...)
+		pd.Imports = append(pd.Imports, imports...)
+		g.beforeRender(k, proxy, &pd)
+		tplPath := g.templatePath(k, proxy)
+		tpl, _, err := g.proxyTemplate(tplPath)
 		if err != nil {
-			log.Panic(err.Error())
+			g.diagnostics.Errorf(k.Pos(), astutils.CodeInvalidTemplate, "%v", err)
+			continue
 		}
 		var buf bytes.Buffer
 		if err := tpl.Execute(&buf, pd); err != nil {
-			log.Panic(err.Error())
+			g.diagnostics.Errorf(k.Pos(), astutils.CodeInvalidTemplate, "%v", err)
+			continue
+		}
+		if !hasGeneratedHeader(bytes.NewReader(buf.Bytes())) {
+			g.diagnostics.Warnf(k.Pos(), astutils.CodeInvalidTemplate,
+				"output of %s does not start with {{ header }}, it will not be recognized as generated", tplPath)
+		}
+		pkg.FileBuf[proxy.Name()] = buf
+		// proxies with problems are rendered again to report them
+		if len(cacheKey) > 0 && g.diagnostics.Len() == diagnostics {
+			g.cachePending[outputName] = [2]string{cacheID, cacheKey}
 		}
-		g.pkgList[proxy.PkgPath()].FileBuf[proxy.Name()] = buf
 	}
+	g.reportLoadErrors()
 	return g
 }
 
+// AdviceStep is one part of the woven chain of a proxied method, in execution order.
+type AdviceStep struct {
+	// Kind is before, around, after, joinpoint or proceed, around advice is split by its proceed call,
+	// joinpoint declares the joinpoint of advice of call mode and invokes their chain, which is
+	// closed by the second joinpoint step, advice of call mode has no statements of its own
+	Kind     string         `json:"kind"`
+	Pointcut string         `json:"pointcut,omitempty"`
+	Aspect   string         `json:"aspect,omitempty"`
+	Pos      token.Position `json:"pos"` // advice declaration
+	Stmts    []string       `json:"stmts"`
+	// Mode is call for advice called on an aspect instance, empty for inlined advice
+	Mode string `json:"mode,omitempty"`
+
+	called aspect.Aspect // the aspect of call mode whose advice is called
+}
+
+// methodPointcuts returns struct level pointcuts of proxy followed by those of method.
+func methodPointcuts(proxy aspect.Proxy, method aspect.Method) []aspect.Pointcut {
+	cuts := append([]aspect.Pointcut{}, proxy.GetPointcuts()...)
+	return append(cuts, method.GetPointcuts()...)
+}
+
+// lookupComponent returns the component of an inject key, an instantiation like pkg.Repo[User]
+// is provided by a generic factory of pkg.Repo, called with the type arguments returned as instance.
+func (g *Generator) lookupComponent(inject string) (comp aspect.Component, instance string, ok bool) {
+	if comp, ok = g.componentCache[inject]; ok || len(inject) == 0 {
+		return comp, "", ok
+	}
+	base := astutils.TrimTypeArgs(inject)
+	if base == inject {
+		return nil, "", false
+	}
+	comp, ok = g.componentCache[base]
+	if !ok || !comp.IsGeneric() {
+		return nil, "", false
+	}
+	return comp, inject[len(base):], true
+}
+
+// isGenericType reports whether name is a generic type declared in pkg.
+func isGenericType(pkg *astutils.Package, name string) bool {
+	if pkg == nil || pkg.AstPkg.Types == nil {
+		return false
+	}
+	named, ok := pkg.AstPkg.Types.Scope().Lookup(name).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	t, ok := named.Type().(*types.Named)
+	return ok && t.TypeParams().Len() > 0
+}
+
+// weaveMethod inlines the advice of cuts around the call of method on the parent:
+// around and before advice in pointcut order, then the call, then after and around
+// advice in reverse order.
+func (g *Generator) weaveMethod(cuts []aspect.Pointcut, method aspect.Method) (*astutils.ProxyMethod, []*astutils.ProxyImport, []AdviceStep) {
+	paramNames, params := method.GetParams()
+	resultNames, results := method.GetResults()
+	m := &astutils.ProxyMethod{
+		Name:        method.Name(),
+		Params:      template.HTML(strings.Join(params, ", ")),
+		ParamNames:  strings.Join(paramNames, ", "),
+		Results:     template.HTML(strings.Join(results, ", ")),
+		ResultNames: strings.Join(resultNames, ", "),
+		TypeArgs:    template.HTML(astutils.ReceiverTypeArgs(method.Func())),
+	}
+	var (
+		imports   []*astutils.ProxyImport
+		steps     []AdviceStep
+		postStack []AdviceStep
+	)
+	imports = append(imports, astutils.GetImports(method.Imports())...)
+	// names of the proxy method and those referred to by advice are kept, colliding locals of advice are renamed
+	scope := astutils.NewScope(append(append([]string{"p"}, paramNames...), resultNames...)...)
+	aspects := make([]aspect.Aspect, len(cuts))
+	for i, cut := range cuts {
+		a, ok := g.resolveAspect(cut.Name())
+		if !ok {
+			g.reportUnknownAspect(cut)
+			continue
+		}
+		aspects[i] = a
+		scope.ReserveAdvice(a.GetBefore())
+		scope.ReserveAdvice(a.GetAfter())
+		scope.ReserveAdvice(a.GetAround())
+	}
+	// advice of call mode runs as one chain of interceptors, whose target is the rest of the method:
+	// the advice of later aspects and the call of the parent
+	var (
+		called       aspect.Aspect // the first aspect of call mode
+		jp           string
+		interceptors []string
+		invoke       int // index of the step invoking the chain in steps
+		ret          int // index of the step returning from the target of the chain in postStack
+		jpStep       = AdviceStep{Kind: "joinpoint", Mode: string(aspect.ModeCall)}
+	)
+	var annotations []string
+	for _, cut := range cuts {
+		if !astutils.IsSystemAnnotation(astutils.Annotation(cut.Name())) {
+			annotations = append(annotations, cut.Name())
+		}
+	}
+	for i, cut := range cuts {
+		aspect := aspects[i]
+		if aspect == nil {
+			continue
+		}
+		if g.isCalled(aspect) {
+			pre, post, calls, ok := g.callAspect(cut, aspect)
+			if !ok {
+				continue
+			}
+			if called == nil {
+				called = aspect
+				jp = scope.Declare("jp")
+				imports = append(imports, astutils.RuntimeImport())
+				// the statements are known once all interceptors are
+				if method.Func() != nil {
+					jpStep.Pos = g.fset.Position(method.Func().Pos())
+				}
+				invoke, ret = len(steps), len(postStack)
+				steps = append(steps, jpStep)
+				postStack = append(postStack, jpStep)
+			}
+			interceptors = append(interceptors, calls...)
+			steps = append(steps, pre...)
+			postStack = append(postStack, post...)
+			continue
+		}
+		imports = append(imports, astutils.GetImports(aspect.Imports())...)
+		before, err := astutils.ParseAdviceStmt(aspect.GetBefore(), method, scope)
+		if err != nil {
+			g.diagnostics.Errorf(aspect.GetBefore().Func().Pos(), astutils.CodeInvalidPlaceholder, "%v", err)
+		}
+		after, err := astutils.ParseAdviceStmt(aspect.GetAfter(), method, scope)
+		if err != nil {
+			g.diagnostics.Errorf(aspect.GetAfter().Func().Pos(), astutils.CodeInvalidPlaceholder, "%v", err)
+		}
+		aroundBefore, aroundAfter, err := astutils.ParseAroundAdvice(aspect.GetAround(), method, scope)
+		if err != nil {
+			g.diagnostics.Errorf(aspect.GetAround().Func().Pos(), astutils.CodeInvalidPlaceholder, "%v", err)
+		}
+		if called != nil && astutils.AdviceReturnsEarly(aspect.GetAround()) {
+			g.diagnostics.Errorf(aspect.GetAround().Func().Pos(), astutils.CodeInvalidAdvice,
+				"around advice %s returns early, which is not supported inside advice of call mode %s",
+				aspect.GetAround().Name(), called.Name())
+		}
+		if s, ok := g.adviceStep("after", cut, aspect.GetAfter(), after); ok {
+			postStack = append(postStack, s)
+		}
+		if s, ok := g.adviceStep("around", cut, aspect.GetAround(), aroundAfter); ok {
+			postStack = append(postStack, s)
+		}
+		if s, ok := g.adviceStep("around", cut, aspect.GetAround(), aroundBefore); ok {
+			steps = append(steps, s)
+		}
+		if s, ok := g.adviceStep("before", cut, aspect.GetBefore(), before); ok {
+			steps = append(steps, s)
+		}
+	}
+	if called != nil {
+		before, after := astutils.ChainStmt(jp, interceptors, method, scope)
+		steps[invoke].Stmts = append(astutils.InvocationStmt(jp, method, annotations), before...)
+		postStack[ret].Stmts = after
+	}
+	for _, s := range steps {
+		for _, v := range s.Stmts {
+			m.Before = append(m.Before, template.HTML(v))
+		}
+	}
+	// invoke method of proxy
+	args, _ := method.GetParams()
+	if method.IsVariadic() && len(args) > 0 {
+		args = append(args[:len(args)-1:len(args)-1], args[len(args)-1]+"...")
+	}
+	proceedStmt := fmt.Sprintf("p.parent.%s(%s)", method.Name(), strings.Join(args, ", "))
+	rets, _ := method.GetResults()
+	if len(rets) > 0 {
+		proceedStmt = fmt.Sprintf("%s = %s", strings.Join(rets, ", "), proceedStmt)
+	}
+	proceed := AdviceStep{Kind: "proceed", Stmts: []string{proceedStmt}}
+	if method.Func() != nil {
+		proceed.Pos = g.fset.Position(method.Func().Pos())
+	}
+	postStack = append(postStack, proceed)
+	// reverse after/around advice
+	for len(postStack) > 0 {
+		n := len(postStack) - 1
+		for _, v := range postStack[n].Stmts {
+			m.After = append(m.After, template.HTML(v))
+		}
+		steps = append(steps, postStack[n])
+		postStack = postStack[:n]
+	}
+	return m, imports, steps
+}
+
+// adviceStep is the step of advice for cut with its statements, false if there is no advice.
+func (g *Generator) adviceStep(kind string, cut aspect.Pointcut, advice aspect.Advice, stmts []string) (AdviceStep, bool) {
+	if advice == nil || advice.Func() == nil {
+		return AdviceStep{}, false
+	}
+	full, _ := g.aspectName(cut.Name())
+	s := AdviceStep{
+		Kind:     kind,
+		Pointcut: cut.Name(),
+		Aspect:   full,
+		Pos:      g.fset.Position(advice.Func().Pos()),
+	}
+	s.Stmts = append(s.Stmts, stmts...)
+	return s, true
+}
+
+// isCalled reports whether the advice of a is called on an instance of the aspect instead of inlined.
+func (g *Generator) isCalled(a aspect.Aspect) bool {
+	mode := a.Mode()
+	if len(mode) == 0 {
+		mode = g.adviceMode
+	}
+	return mode == aspect.ModeCall
+}
+
+// callAspect returns the steps of the advice of a in call mode, around and before advice, then after
+// and around advice in the order they are pushed to be reversed, and the interceptors calling the
+// advice in chain order. It returns false if a has no advice or any of it cannot be called.
+func (g *Generator) callAspect(cut aspect.Pointcut, a aspect.Aspect) ([]AdviceStep, []AdviceStep, []string, bool) {
+	if adviceOf(a) == nil {
+		return nil, nil, nil, false
+	}
+	recv := "p." + aspectField(a)
+	failed := false
+	var interceptors []string
+	// after advice wraps around advice, which wraps before advice, as they are inlined
+	for _, v := range []struct {
+		advice aspect.Advice
+		kind   astutils.Annotation
+	}{
+		{a.GetAfter(), astutils.CommentAdviceAfter},
+		{a.GetAround(), astutils.CommentAdviceAround},
+		{a.GetBefore(), astutils.CommentAdviceBefore},
+	} {
+		if v.advice == nil || v.advice.Func() == nil {
+			continue
+		}
+		call, err := astutils.CallInterceptor(v.advice, recv, v.kind)
+		if err != nil {
+			failed = true
+			g.diagnostics.Errorf(v.advice.Func().Pos(), astutils.CodeInvalidAdvice, "%v", err)
+			continue
+		}
+		interceptors = append(interceptors, call)
+	}
+	if failed {
+		return nil, nil, nil, false
+	}
+	var pre, post []AdviceStep
+	add := func(list *[]AdviceStep, kind string, advice aspect.Advice) {
+		if s, ok := g.adviceStep(kind, cut, advice, nil); ok {
+			s.Mode = string(aspect.ModeCall)
+			s.called = a
+			*list = append(*list, s)
+		}
+	}
+	add(&pre, "around", a.GetAround())
+	add(&pre, "before", a.GetBefore())
+	add(&post, "after", a.GetAfter())
+	add(&post, "around", a.GetAround())
+	return pre, post, interceptors, true
+}
+
+// addAspectField adds the field holding the instance of a, an aspect of call mode, to the proxy
+// once, called are the aspects added by field name.
+func (g *Generator) addAspectField(pd *astutils.ProxyData, proxy aspect.Proxy, a aspect.Aspect, called map[string]aspect.Aspect) {
+	name := aspectField(a)
+	if v, ok := called[name]; ok || name == "parent" {
+		if v != a {
+			g.diagnostics.Errorf(adviceOf(a).Func().Pos(), astutils.CodeInvalidAdvice,
+				"field %s of %s%s holding aspect %s is in use", name, proxy.Name(), proxy.Suffix(), a.Name())
+		}
+		return
+	}
+	called[name] = a
+	typ := a.Name()
+	if a.PkgPath() != proxy.PkgPath() {
+		for _, v := range []aspect.Advice{a.GetAround(), a.GetBefore(), a.GetAfter()} {
+			if v != nil && v.Func() != nil && !(ast.IsExported(a.Name()) && ast.IsExported(v.Name())) {
+				g.diagnostics.Errorf(v.Func().Pos(), astutils.CodeInvalidAdvice,
+					"advice %s.%s is called by %s of another package, both are exported", a.Name(), v.Name(), proxy.Name())
+			}
+		}
+		typ = a.PkgName() + "." + typ
+		pd.Imports = append(pd.Imports, importOf(a.PkgPath(), a.PkgName()))
+	}
+	val := "&" + typ + "{}"
+	if comp, instance, ok := g.lookupComponent(a.PkgPath() + ".*" + a.Name()); ok {
+		facPkg, facPkgName, facName := comp.Factory()
+		val = facName + instance + "()"
+		if facPkg != proxy.PkgPath() {
+			val = facPkgName + "." + val
+			pd.Imports = append(pd.Imports, importOf(facPkg, facPkgName))
+		}
+	}
+	pd.Aspects = append(pd.Aspects, &astutils.ProxyAspectField{
+		Var:  template.HTML(name),
+		Type: template.HTML("*" + typ),
+		Val:  template.HTML(val),
+	})
+}
+
+// importOf imports pkgPath by name, an alias if it is not the last element of pkgPath.
+func importOf(pkgPath, name string) *astutils.ProxyImport {
+	imp := &astutils.ProxyImport{Path: template.HTML(strconv.Quote(pkgPath))}
+	if name != path.Base(pkgPath) {
+		imp.Alias = template.HTML(name)
+	}
+	return imp
+}
+
+// adviceOf returns the first advice a declares, nil if there is none.
+func adviceOf(a aspect.Aspect) aspect.Advice {
+	for _, v := range []aspect.Advice{a.GetAround(), a.GetBefore(), a.GetAfter()} {
+		if v != nil && v.Func() != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// aspectField is the field of the proxy holding the instance of an aspect of call mode.
+func aspectField(a aspect.Aspect) string {
+	name := []rune(a.Name())
+	name[0] = unicode.ToLower(name[0])
+	return string(name)
+}
+
+// resolveAspect finds the aspect of a pointcut name, which is an alias,
+// a custom annotation or the full name of the aspect.
+func (g *Generator) resolveAspect(name string) (aspect.Aspect, bool) {
+	full, _ := g.aspectName(name)
+	a, ok := g.aspectCache[full]
+	return g.pluginAspect(name, a, ok)
+}
+
+// aspectName returns the full name of the aspect of a pointcut name and how it was resolved.
+func (g *Generator) aspectName(name string) (string, string) {
+	if alias, ok := g.aspectAlias[name]; ok {
+		return alias, ResolvedByAlias
+	}
+	if anno, ok := g.aspectCustoms[astutils.Annotation(name)]; ok {
+		return anno, ResolvedByCustom
+	}
+	return name, ResolvedByFullName
+}
+
+// reportUnknownAspect reports a pointcut whose name does not resolve to any aspect.
+func (g *Generator) reportUnknownAspect(cut aspect.Pointcut) {
+	name := cut.Name()
+	anno := astutils.Annotation(name)
+	if len(name) == 0 || astutils.IsSystemAnnotation(anno) {
+		return
+	}
+	if strings.HasPrefix(name, "@") {
+		g.diagnostics.Warnf(cut.Pos(), astutils.CodeUnknownAspect,
+			"annotation %s does not match any custom aspect", name)
+		return
+	}
+	g.diagnostics.Errorf(cut.Pos(), astutils.CodeUnknownAspect, "unknown aspect %q", name)
+}
+
+// proxyPos returns the declaration position of the proxy named name in package path.
+func (g *Generator) proxyPos(path, name string) token.Pos {
+	for k, proxy := range g.proxyCache {
+		if proxy.PkgPath() == path && proxy.Name() == name {
+			return k.Pos()
+		}
+	}
+	return token.NoPos
+}
+
+type proxyTemplate struct {
+	tpl  *template.Template
+	text string
+	err  error
+}
+
+// templatePath returns the template file of proxy, from template= of @Proxy relative to
+// the package directory, or the project template, empty for the default template.
+func (g *Generator) templatePath(k *ast.Ident, proxy aspect.Proxy) string {
+	if path := proxy.Template(); len(path) > 0 {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(filepath.Dir(g.fset.Position(k.Pos()).Filename), path)
+	}
+	if len(g.templateFile) == 0 || filepath.IsAbs(g.templateFile) {
+		return g.templateFile
+	}
+	return absPath(filepath.Join(g.dir, g.templateFile))
+}
+
+// proxyTemplate parses the template file at path once, an empty path is the default template.
+func (g *Generator) proxyTemplate(path string) (*template.Template, string, error) {
+	if t, ok := g.templates[path]; ok {
+		return t.tpl, t.text, t.err
+	}
+	t := &proxyTemplate{text: astutils.GetProxyTpl()}
+	g.templates[path] = t
+	name := "proxy"
+	if len(path) > 0 {
+		name = filepath.Base(path)
+		data, ok := g.overlay[path]
+		if !ok {
+			var err error
+			if data, err = os.ReadFile(path); err != nil {
+				t.err = err
+				return nil, "", err
+			}
+		}
+		t.text = string(data)
+	}
+	t.tpl, t.err = astutils.ParseProxyTemplate(name, t.text)
+	return t.tpl, t.text, t.err
+}
+
+// Diagnostics returns errors and warnings collected so far, sorted by position.
+func (g *Generator) Diagnostics() []astutils.Diagnostic {
+	return g.diagnostics.List()
+}
+
 // Format returns the gofmt-ed contents of the Generator's buffer.
 func (g *Generator) Format() *Generator {
 	for _, pkg := range g.pkgList {
 		for k, v := range pkg.FileBuf {
+			if _, ok := pkg.Unchanged[k]; ok {
+				pkg.OutputFiles[k] = v.Bytes()
+				continue
+			}
 			src, err := imports.Process("", v.Bytes(), nil)
 			if err != nil {
 				log.Println("output file:\n", v.String())
 				// Should never happen, but can arise when developing this code.
 				// The user can compile the output to see the error.
-				log.Printf("warning: internal error: invalid Go generated: %s", err)
-				log.Printf("warning: compile the package to analyze the error")
+				g.diagnostics.Errorf(g.proxyPos(pkg.Path, k), astutils.CodeInvalidGenerated,
+					"internal error: invalid Go generated for %s: %s", k, err)
 				continue
 			}
+			if targetDir, ok := g.targetDir(pkg); ok {
+				src = g.afterFormat(g.proxyPos(pkg.Path, k), g.outputPath(pkg, targetDir, k), src)
+			}
 			pkg.OutputFiles[k] = src
 		}
 	}
+	for name, v := range g.emitted {
+		if filepath.Ext(name) == ".go" {
+			src, err := imports.Process(name, v, nil)
+			if err != nil {
+				g.diagnostics.Errorf(token.NoPos, astutils.CodeInvalidGenerated,
+					"invalid Go emitted as %s: %s", name, err)
+				delete(g.emitted, name)
+				continue
+			}
+			v = src
+		}
+		g.emitted[name] = g.afterFormat(token.NoPos, name, v)
+	}
 	return g
 }
 
-// Output create proxy file by Generator's buffer.
+// Output create proxy file by Generator's buffer, and prunes generated files
+// which no longer belong to any proxy.
+// In check mode nothing is written, stale and orphaned files are reported instead.
 func (g *Generator) Output() *Generator {
+	if g.err != nil {
+		return g
+	}
+	// proxies of a broken load may be incomplete, the files on disk are kept until it is fixed
+	if !g.check && g.diagnostics.HasErrors() {
+		log.Printf("skip writing generated files as generation has errors")
+		return g
+	}
+	var orphans []string
 	for _, pkg := range g.pkgList {
+		targetDir, ok := g.targetDir(pkg)
+		// not current project package
+		if !ok {
+			continue
+		}
 		for k, v := range pkg.OutputFiles {
 			// Write to file.
-			outputName := ""
-			if outputName == "" {
-				targetPkg := getRelevantPkg(pkg.Pwd, pkg.Path)
-				// not current project package
-				if len(targetPkg) == 0 {
-					continue
-				}
-				baseName := fmt.Sprintf("%s_proxy.gen.go", k)
-				log.Printf("current pkg is %s target pkg is %s target relevant pkg is %s", pkg.Pwd, pkg.Path, targetPkg)
-				outputName = filepath.Join(targetPkg, strings.ToLower(baseName))
+			outputName := g.outputPath(pkg, targetDir, k)
+			if g.check {
+				g.compare(outputName, v)
+				continue
+			}
+			if e, ok := g.cachePending[outputName]; ok {
+				g.cache.store(e[0], e[1], outputName, v)
+			}
+			if _, ok := pkg.Unchanged[k]; ok {
+				continue
+			}
+			if err := os.MkdirAll(targetDir, 0o755); err != nil {
+				return g.fail("writing output: %w", err)
 			}
 			err := ioutil.WriteFile(outputName, v, 0o644)
 			if err != nil {
-				log.Fatalf("writing output: %s", err)
+				return g.fail("writing output: %w", err)
 			}
+			g.written = append(g.written, outputName)
+		}
+		orphans = append(orphans, g.orphans(pkg, targetDir)...)
+	}
+	for _, e := range g.skipped {
+		orphans = append(orphans, e.orphans()...)
+	}
+	for name, v := range g.emitted {
+		if g.check {
+			g.compare(name, v)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return g.fail("writing output: %w", err)
+		}
+		if err := ioutil.WriteFile(name, v, 0o644); err != nil {
+			return g.fail("writing output: %w", err)
+		}
+		g.written = append(g.written, name)
+	}
+	if g.check {
+		for _, name := range orphans {
+			g.compare(name, nil)
 		}
+		return g
+	}
+	if g.prune {
+		g.remove(orphans)
+	}
+	if g.incremental {
+		g.storePackages()
+	}
+	if err := g.cache.save(); err != nil {
+		log.Printf("warning: saving cache: %s", err)
 	}
 	return g
 }
 
-var (
-	buildTags string
-	recursive bool
-	deps      string
-)
+// Result is the outcome of a generation without touching the filesystem.
+type Result struct {
+	// Files maps absolute target path to generated source
+	Files map[string][]byte
+	// Orphans are generated files on disk which no longer belong to any proxy
+	Orphans     []string
+	Diagnostics []astutils.Diagnostic
+}
+
+// Result returns generated sources and diagnostics, use it in place of Output
+// to run the generator in memory.
+func (g *Generator) Result() *Result {
+	r := &Result{Files: map[string][]byte{}}
+	for _, pkg := range g.pkgList {
+		targetDir, ok := g.targetDir(pkg)
+		if !ok {
+			continue
+		}
+		for k, v := range pkg.OutputFiles {
+			r.Files[absPath(g.outputPath(pkg, targetDir, k))] = v
+		}
+		for _, name := range g.orphans(pkg, targetDir) {
+			r.Orphans = append(r.Orphans, absPath(name))
+		}
+	}
+	for _, e := range g.skipped {
+		for name := range e.Outputs {
+			if data, err := os.ReadFile(name); err == nil {
+				r.Files[absPath(name)] = data
+			}
+		}
+		for _, name := range e.orphans() {
+			r.Orphans = append(r.Orphans, absPath(name))
+		}
+	}
+	for name, v := range g.emitted {
+		r.Files[absPath(name)] = v
+	}
+	sort.Strings(r.Orphans)
+	r.Diagnostics = g.Diagnostics()
+	return r
+}
+
+// Clean removes generated files which no longer belong to any proxy, without writing others.
+func (g *Generator) Clean() *Generator {
+	if g.err != nil {
+		return g
+	}
+	var orphans []string
+	for _, pkg := range g.pkgList {
+		if targetDir, ok := g.targetDir(pkg); ok {
+			orphans = append(orphans, g.orphans(pkg, targetDir)...)
+		}
+	}
+	for _, e := range g.skipped {
+		orphans = append(orphans, e.orphans()...)
+	}
+	g.remove(orphans)
+	return g
+}
+
+// Written returns files written by the last Output, unchanged files are not written.
+func (g *Generator) Written() []string {
+	sort.Strings(g.written)
+	return g.written
+}
+
+// Removed returns generated files pruned by the last Output or Clean, or listed in dry-run mode.
+func (g *Generator) Removed() []string {
+	sort.Strings(g.removed)
+	return g.removed
+}
+
+// targetDir returns the directory of generated files of pkg, false for packages out of the main
+// modules, which are those of the workspace in workspace mode.
+func (g *Generator) targetDir(pkg *astutils.Package) (string, bool) {
+	p := pkg.AstPkg
+	if p == nil || p.Module == nil || !p.Module.Main || len(p.GoFiles) == 0 {
+		return "", false
+	}
+	dir := filepath.Dir(p.GoFiles[0])
+	if len(g.outputDir) == 0 {
+		return dir, true
+	}
+	rel, err := filepath.Rel(absPath(g.dir), dir)
+	if err != nil {
+		return "", false
+	}
+	if filepath.IsAbs(g.outputDir) {
+		return filepath.Join(g.outputDir, rel), true
+	}
+	return filepath.Join(g.dir, g.outputDir, rel), true
+}
+
+func (g *Generator) outputPath(pkg *astutils.Package, targetDir, name string) string {
+	// the output name is validated by ParsePackage
+	baseName, _ := outputFileName(g.outputName, pkg.Name, name)
+	return filepath.Join(targetDir, baseName)
+}
+
+// orphans lists generated files in targetDir which do not belong to any proxy of pkg.
+func (g *Generator) orphans(pkg *astutils.Package, targetDir string) []string {
+	expected := map[string]struct{}{}
+	// proxies failed to format still own their files
+	for k := range pkg.FileBuf {
+		expected[g.outputPath(pkg, targetDir, k)] = struct{}{}
+	}
+	for name := range g.emitted {
+		expected[name] = struct{}{}
+	}
+	var list []string
+	for _, name := range getGeneratedFiles(targetDir) {
+		if _, ok := expected[name]; !ok {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+func (g *Generator) remove(orphans []string) {
+	if len(orphans) > 0 && g.diagnostics.HasErrors() {
+		log.Printf("skip removing %d orphaned file(s) as generation has errors", len(orphans))
+		return
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		g.removed = append(g.removed, name)
+		if g.dryRun {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			g.fail("removing output: %w", err)
+			return
+		}
+		log.Printf("removed orphaned %s", name)
+	}
+}
+
+// compare records outputName as stale when its content on disk differs from src,
+// a nil src means the file should not exist.
+func (g *Generator) compare(outputName string, src []byte) {
+	old, err := ioutil.ReadFile(outputName)
+	if err != nil && !os.IsNotExist(err) {
+		g.fail("reading output: %w", err)
+		return
+	}
+	if err == nil && src != nil && bytes.Equal(old, src) {
+		return
+	}
+	g.stale = append(g.stale, outputName)
+	switch {
+	case src == nil:
+		log.Printf("%s is orphaned", outputName)
+	case err != nil:
+		log.Printf("%s is missing", outputName)
+	default:
+		log.Printf("%s is stale", outputName)
+	}
+	if g.diff {
+		g.diffs[outputName] = unifiedDiff(outputName, old, src)
+	}
+}
+
+// Diffs returns the unified diffs of stale files by name, recorded by the last Output with WithDiff.
+func (g *Generator) Diffs() map[string]string {
+	return g.diffs
+}
 
-// Usage is a replacement usage function for the flags package.
-func usage() {
-	fmt.Fprintf(os.Stderr, "Usage of Aspect:\n")
-	fmt.Fprintf(os.Stderr, "For more information, see:\n")
-	fmt.Fprintf(os.Stderr, "\thttps://github.com/go-park/sandwich\n")
-	fmt.Fprintf(os.Stderr, "Flags:\n")
-	flag.PrintDefaults()
-}
-
-func Do(opts ...Option) {
-	log.SetFlags(0)
-	log.SetPrefix("aspect: ")
-	flag.StringVar(&buildTags, "tags", "", "comma-separated list of build tags to apply")
-	flag.BoolVar(&recursive, "recursive", true, "true or false package load recursively, default true")
-	flag.BoolVar(&recursive, "r", true, "true or false package load recursively, default true")
-	flag.StringVar(&deps, "deps", "", "comma-separated list of dependencies need scan")
-
-	flag.Usage = usage
-	flag.Parse()
-
-	opts = append([]Option{
-		WithPatterns(flag.Args()...),
-		WithRecursive(recursive),
-		WithDeps(strings.Split(deps, ",")...),
-		WithTags(strings.Split(buildTags, ",")...),
-	}, opts...)
-
-	NewGenerator(opts...).ParsePackage().Generate().Format().Output()
+// Stale returns files found out of date by the last Output in check mode.
+func (g *Generator) Stale() []string {
+	sort.Strings(g.stale)
+	return g.stale
 }
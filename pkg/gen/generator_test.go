@@ -0,0 +1,337 @@
+package gen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator_Result(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	src, err := os.ReadFile(filepath.Join(dir, "bar.go"))
+	assert.NoError(t, err)
+	src = append(src, []byte("\nfunc (s *Bar) Baz(ctx context.Context) error { return nil }\n")...)
+
+	r := NewGenerator(
+		WithDir(dir),
+		WithTags("sandwich"),
+		WithCache(false),
+		WithOverlay(map[string][]byte{filepath.Join(dir, "bar.go"): src}),
+	).ParsePackage().Generate().Format().Result()
+
+	assert.Empty(t, r.Diagnostics)
+	assert.Empty(t, r.Orphans)
+	assert.Len(t, r.Files, 2)
+	bar := string(r.Files[filepath.Join(dir, "bar_proxy.gen.go")])
+	assert.Contains(t, bar, "return &BarProxy{parent: pa}")
+	assert.Contains(t, bar, "func (p *BarProxy) Baz(ctx context.Context) (r0 error) {")
+	// @Value is an extension of the examples, not registered here
+	foo := string(r.Files[filepath.Join(dir, "foo_proxy.gen.go")])
+	assert.Contains(t, foo, "_FooProxyInst = &FooProxy{")
+	assert.NotContains(t, foo, `str: "123"`)
+}
+
+func TestGenerator_loadErrors(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	src, err := os.ReadFile(filepath.Join(dir, "bar.go"))
+	assert.NoError(t, err)
+	lines := strings.Count(string(src), "\n")
+	src = append(src, []byte("\nvar _ int = \"x\"\n")...)
+
+	g := NewGenerator(
+		WithDir(dir),
+		WithTags("sandwich"),
+		WithCache(false),
+		WithOverlay(map[string][]byte{filepath.Join(dir, "bar.go"): src}),
+	).ParsePackage().Generate().Format().Output()
+
+	if diags := g.Diagnostics(); assert.Len(t, diags, 1) {
+		assert.Equal(t, astutils.CodeInvalidPackage, diags[0].Code)
+		assert.Equal(t, filepath.Join(dir, "bar.go"), diags[0].Pos.Filename)
+		assert.Equal(t, lines+2, diags[0].Pos.Line)
+	}
+	assert.Empty(t, g.Written())
+}
+
+func Test_errorPosition(t *testing.T) {
+	for pos, want := range map[string]token.Position{
+		"/a/b.go:3:7":   {Filename: "/a/b.go", Line: 3, Column: 7},
+		"/a/b.go:3":     {Filename: "/a/b.go", Line: 3},
+		"c:/a/b.go:3:7": {Filename: "c:/a/b.go", Line: 3, Column: 7},
+		"-":             {},
+		"":              {},
+	} {
+		assert.Equal(t, want, errorPosition(pos), pos)
+	}
+}
+
+func TestGenerator_syntax(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	// generators of different syntax run at once, the examples are written as comments
+	want := map[astutils.AnnotationSyntax]int{astutils.SyntaxComment: 2, astutils.SyntaxDirective: 0}
+	got := map[astutils.AnnotationSyntax]int{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for syntax := range want {
+		wg.Add(1)
+		go func(syntax astutils.AnnotationSyntax) {
+			defer wg.Done()
+			l := NewGenerator(WithDir(dir), WithTags("sandwich"), WithCache(false), WithAnnotationSyntax(syntax)).
+				ParsePackage().List()
+			mu.Lock()
+			got[syntax] = len(l.Proxies)
+			mu.Unlock()
+		}(syntax)
+	}
+	wg.Wait()
+	assert.Equal(t, want, got)
+}
+
+func TestGenerator_Explain(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	g := NewGenerator(WithDir(dir), WithTags("sandwich"), WithCache(false)).ParsePackage()
+
+	e, err := g.Explain("main.Bar.Foo")
+	assert.NoError(t, err)
+	if assert.Len(t, e.Pointcuts, 1) {
+		assert.Equal(t, "@Transactional", e.Pointcuts[0].Name)
+		assert.Equal(t, ResolvedByCustom, e.Pointcuts[0].Resolution)
+		assert.Equal(t, "aspect.AspectTrans", e.Pointcuts[0].Aspect)
+	}
+	var kinds []string
+	for _, v := range e.Steps {
+		kinds = append(kinds, v.Kind)
+	}
+	assert.Equal(t, []string{"around", "before", "proceed", "around", "after"}, kinds)
+
+	_, err = g.Explain("main.Bar.Baz")
+	assert.EqualError(t, err, "Bar has no method Baz")
+}
+
+func TestGenerator_Graph(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	gr := NewGenerator(WithDir(dir), WithTags("sandwich"), WithCache(false)).ParsePackage().Graph()
+
+	assert.Len(t, gr.Nodes, 3)
+	assert.Equal(t, []GraphEdge{
+		{From: "github.com/go-park/sandwich/examples.IBar", To: "github.com/go-park/sandwich/examples.IFoo", Kind: EdgeInject, Field: "foo"},
+		{From: "github.com/go-park/sandwich/examples.IBar", To: "github.com/go-park/sandwich/examples/lib.Foo", Kind: EdgeInject, Field: "libFoo"},
+		{From: "github.com/go-park/sandwich/examples.IFoo", To: "github.com/go-park/sandwich/examples/lib.Foo", Kind: EdgeInject, Field: "foo"},
+	}, gr.Edges)
+	dot, err := gr.Format(GraphDOT)
+	assert.NoError(t, err)
+	assert.Contains(t, dot, `[label="examples.IFoo\nexamples.NewFooProxy() singleton", shape=box, style=bold];`)
+	_, err = gr.Format("svg")
+	assert.Error(t, err)
+}
+
+func TestGenerator_Graph_generic(t *testing.T) {
+	dir, err := filepath.Abs("../gentest/testdata/generic")
+	assert.NoError(t, err)
+	gr := NewGenerator(WithDir(dir), WithPatterns("."), WithTags("sandwich"), WithCache(false)).ParsePackage().Graph()
+
+	const pkg = "github.com/go-park/sandwich/pkg/gentest/testdata/generic"
+	assert.Equal(t, []GraphEdge{
+		{From: pkg + ".IRepo", To: pkg + "/store.*Store", Kind: EdgeInject, Field: "store"},
+		{From: pkg + ".UserService", To: pkg + ".IRepo", Kind: EdgeInject, Field: "users"},
+	}, gr.Edges)
+	for _, n := range gr.Nodes {
+		assert.NotEqual(t, NodeUnresolved, n.Kind, n.ID)
+	}
+}
+
+func TestGenerator_lookupComponent(t *testing.T) {
+	g := NewGenerator()
+	for _, c := range []aspect.Component{
+		aspect.NewComponent(aspect.WithComponentName("m.IRepo"), aspect.WithComponentFactory("m", "NewRepoProxy"),
+			aspect.WithComponentGeneric(true)),
+		aspect.NewComponent(aspect.WithComponentName("m.IRepo[Admin]"), aspect.WithComponentFactory("m", "NewAdminRepo")),
+		aspect.NewComponent(aspect.WithComponentName("m.*Store"), aspect.WithComponentFactory("m", "NewStore")),
+	} {
+		g.componentCache[c.Name()] = c
+	}
+	tests := []struct {
+		inject   string
+		factory  string
+		instance string
+	}{
+		{inject: "m.IRepo", factory: "NewRepoProxy"},
+		{inject: "m.IRepo[User]", factory: "NewRepoProxy", instance: "[User]"},
+		{inject: "m.IRepo[map[string][]int]", factory: "NewRepoProxy", instance: "[map[string][]int]"},
+		// an instantiation with a factory of its own is not provided by the generic one
+		{inject: "m.IRepo[Admin]", factory: "NewAdminRepo"},
+		// a component which is not generic has no instantiations
+		{inject: "m.*Store[User]"},
+		{inject: "m.IUnknown[User]"},
+		{inject: ""},
+	}
+	for _, tt := range tests {
+		comp, instance, ok := g.lookupComponent(tt.inject)
+		if len(tt.factory) == 0 {
+			assert.False(t, ok, tt.inject)
+			continue
+		}
+		if assert.True(t, ok, tt.inject) {
+			_, _, factory := comp.Factory()
+			assert.Equal(t, tt.factory, factory, tt.inject)
+			assert.Equal(t, tt.instance, instance, tt.inject)
+		}
+	}
+}
+
+func TestGenerator_weaveMethod_variadic(t *testing.T) {
+	tests := []struct {
+		src, proceed string
+	}{
+		{"func (s *S) Log(ctx context.Context, args ...any)", "p.parent.Log(ctx, args...)"},
+		{"func (s *S) Join(sep string, parts ...string) string", "r0 = p.parent.Join(sep, parts...)"},
+		{"func (s *S) Sum(nums []int) (int, error)", "r0, r1 = p.parent.Sum(nums)"},
+		{"func (s *S) Only(args ...int)", "p.parent.Only(args...)"},
+	}
+	for _, tt := range tests {
+		g := NewGenerator()
+		file, err := parser.ParseFile(g.fset, "p.go", "package p\n\n"+tt.src+" {}\n", 0)
+		if !assert.NoError(t, err, tt.src) {
+			continue
+		}
+		method := aspect.NewMethod(aspect.WithMethodDecl(file.Decls[0].(*ast.FuncDecl)))
+		_, _, steps := g.weaveMethod(nil, method)
+		if assert.Len(t, steps, 1, tt.src) {
+			assert.Equal(t, "proceed", steps[0].Kind)
+			assert.Equal(t, []string{tt.proceed}, steps[0].Stmts)
+		}
+	}
+}
+
+// copyExamples copies the examples to a directory of the module, left out of ./... by its name,
+// with imports of the examples rewritten.
+func copyExamples(t *testing.T) string {
+	dir, err := os.MkdirTemp(".", "_examples")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	dir, err = filepath.Abs(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "aspect"), 0o755))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0o755))
+	for _, name := range []string{"bar.go", "foo.go", "aspect/log.go", "aspect/trans.go", "aspect/validator.go", "lib/foo.go", "lib/init.go"} {
+		src, err := os.ReadFile(filepath.Join("../../examples", name))
+		assert.NoError(t, err)
+		src = bytes.ReplaceAll(src, []byte("sandwich/examples/"), []byte("sandwich/pkg/gen/"+filepath.Base(dir)+"/"))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), src, 0o644))
+	}
+	return dir
+}
+
+type testPlugin struct {
+	methods []string
+	formats int
+}
+
+func (p *testPlugin) Name() string { return "test" }
+
+func (p *testPlugin) AfterParse(ctx *PluginContext) error {
+	for _, proxy := range ctx.Proxies() {
+		src := "// Code generated by sandwich. DO NOT EDIT.\n\npackage " + proxy.PkgName() +
+			"\n\nconst " + proxy.Name() + "Name = \"" + proxy.Name() + "\"\n"
+		if err := ctx.Emit(proxy.PkgPath(), strings.ToLower(proxy.Name())+"_name.gen.go", []byte(src)); err != nil {
+			return err
+		}
+	}
+	return ctx.Emit("unknown", "x.go", nil)
+}
+
+func (p *testPlugin) Method(ctx *PluginContext, proxy aspect.Proxy, method aspect.Method, m *astutils.ProxyMethod) error {
+	p.methods = append(p.methods, proxy.Name()+"."+m.Name)
+	return nil
+}
+
+func (p *testPlugin) BeforeRender(ctx *PluginContext, proxy aspect.Proxy, data *astutils.ProxyData) error {
+	data.ProxyStructName = proxy.Name() + "Wrapper"
+	return nil
+}
+
+func (p *testPlugin) AfterFormat(ctx *PluginContext, path string, src []byte) ([]byte, error) {
+	p.formats++
+	return append(src, "// formatted\n"...), nil
+}
+
+func TestGenerator_Plugin(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	p := &testPlugin{}
+	r := NewGenerator(WithDir(dir), WithTags("sandwich"), WithPlugins(p)).
+		ParsePackage().Generate().Format().Result()
+
+	if assert.Len(t, r.Diagnostics, 1) {
+		assert.Equal(t, astutils.CodePlugin, r.Diagnostics[0].Code)
+		assert.Equal(t, "plugin test: emit x.go: unknown package unknown", r.Diagnostics[0].Message)
+	}
+	sort.Strings(p.methods)
+	assert.Equal(t, []string{"Bar.Bar", "Bar.Foo", "Foo.Foo"}, p.methods)
+	assert.Len(t, r.Files, 4)
+	assert.Equal(t, 4, p.formats)
+	assert.Contains(t, string(r.Files[filepath.Join(dir, "bar_proxy.gen.go")]), "type BarWrapper struct")
+	assert.Equal(t, "// Code generated by sandwich. DO NOT EDIT.\n\npackage main\n\nconst BarName = \"Bar\"\n// formatted\n",
+		string(r.Files[filepath.Join(dir, "bar_name.gen.go")]))
+	assert.Empty(t, r.Orphans)
+}
+
+func TestGenerator_skipUnchanged(t *testing.T) {
+	dir := copyExamples(t)
+	cacheDir := t.TempDir()
+	run := func() *Generator {
+		return NewGenerator(WithDir(dir), WithTags("sandwich"), WithCacheDir(cacheDir)).
+			ParsePackage().Generate().Format().Output()
+	}
+
+	g := run()
+	assert.Empty(t, g.Diagnostics())
+	assert.Len(t, g.Written(), 2)
+
+	g = run()
+	assert.Empty(t, g.loaded)
+	assert.Len(t, g.skipped, 3)
+	assert.Empty(t, g.Written())
+	assert.Len(t, g.Result().Files, 2)
+
+	bar := filepath.Join(dir, "bar.go")
+	src, err := os.ReadFile(bar)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(bar, append(src, "\nfunc (s *Bar) Baz() {}\n"...), 0o644))
+	// packages declaring aspects are loaded along with the changed one, components
+	// of the others are cached
+	g = run()
+	assert.Len(t, g.loaded, 2)
+	assert.Contains(t, g.skipped, filepath.Join(dir, "lib"))
+	assert.Equal(t, []string{filepath.Join(dir, "bar_proxy.gen.go")}, g.Written())
+
+	// proxies injecting a component of another package follow the renamed factory
+	foo := filepath.Join(dir, "lib", "foo.go")
+	src, err = os.ReadFile(foo)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(foo, bytes.Replace(src, []byte("func NewFoo() Foo"), []byte("func NewFooImpl() Foo"), 1), 0o644))
+	g = run()
+	assert.Empty(t, g.Diagnostics())
+	assert.NotContains(t, g.skipped, dir)
+	for _, name := range []string{"foo_proxy.gen.go", "bar_proxy.gen.go"} {
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), "lib.NewFooImpl()", name)
+	}
+}
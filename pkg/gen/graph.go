@@ -0,0 +1,211 @@
+package gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+// Graph formats.
+const (
+	GraphDOT     = "dot"
+	GraphMermaid = "mermaid"
+	GraphJSON    = "json"
+)
+
+// Kinds of graph nodes and edges.
+const (
+	NodeComponent  = "component"
+	NodeProxy      = "proxy"
+	NodeValue      = "value"
+	NodeUnresolved = "unresolved"
+	EdgeInject     = "inject"
+	EdgeValue      = "value"
+)
+
+type (
+	// Graph is the injection graph of components, from proxies to what their fields are assigned.
+	Graph struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}
+	GraphNode struct {
+		ID        string `json:"id"`
+		Kind      string `json:"kind"`
+		Package   string `json:"package,omitempty"` // package of the factory
+		Factory   string `json:"factory,omitempty"`
+		Proxy     string `json:"proxy,omitempty"` // struct proxied by the component
+		Singleton bool   `json:"singleton"`
+		Value     string `json:"value,omitempty"`
+	}
+	GraphEdge struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Kind  string `json:"kind"`
+		Field string `json:"field"`
+	}
+)
+
+// Graph returns the injection graph of the parsed packages: components, proxies, @Inject
+// fields and values assigned by field interceptors such as @Value.
+func (g *Generator) Graph() *Graph {
+	g.inspect()
+	gr := &Graph{}
+	nodes := map[string]*GraphNode{}
+	addNode := func(n GraphNode) {
+		if _, ok := nodes[n.ID]; !ok {
+			nodes[n.ID] = &n
+		}
+	}
+	proxyFactories := map[string]struct{}{}
+	for k, proxy := range g.proxyCache {
+		if !k.IsExported() {
+			continue
+		}
+		// the component of the proxy, a generic proxy provides every instantiation
+		id := proxy.PkgPath() + "." + astutils.TrimTypeArgs(proxy.Abstract())
+		if len(proxy.Abstract()) == 0 {
+			id = proxy.PkgPath() + "." + proxy.Name()
+		}
+		factory := "New" + proxy.Name() + proxy.Suffix()
+		proxyFactories[proxy.PkgPath()+"."+factory] = struct{}{}
+		addNode(GraphNode{
+			ID:        id,
+			Kind:      NodeProxy,
+			Package:   proxy.PkgPath(),
+			Factory:   factory,
+			Proxy:     proxy.PkgPath() + "." + proxy.Name(),
+			Singleton: proxy.IsSingleton(),
+		})
+		for _, f := range proxy.Fields() {
+			switch {
+			case len(f.Assign()) > 0:
+				to := id + "." + f.Name()
+				addNode(GraphNode{ID: to, Kind: NodeValue, Value: f.Assign()})
+				gr.Edges = append(gr.Edges, GraphEdge{From: id, To: to, Kind: EdgeValue, Field: f.Name()})
+			case len(f.Inject()) > 0:
+				to := f.Inject()
+				if comp, _, ok := g.lookupComponent(to); ok {
+					to = comp.Name()
+				}
+				gr.Edges = append(gr.Edges, GraphEdge{From: id, To: to, Kind: EdgeInject, Field: f.Name()})
+			}
+		}
+	}
+	for name, comp := range g.componentCache {
+		facPkg, _, facName := comp.Factory()
+		if _, ok := proxyFactories[facPkg+"."+facName]; ok {
+			continue
+		}
+		addNode(GraphNode{ID: name, Kind: NodeComponent, Package: facPkg, Factory: facName})
+	}
+	for _, e := range gr.Edges {
+		addNode(GraphNode{ID: e.To, Kind: NodeUnresolved})
+	}
+	for _, n := range nodes {
+		gr.Nodes = append(gr.Nodes, *n)
+	}
+	sort.Slice(gr.Nodes, func(i, j int) bool { return gr.Nodes[i].ID < gr.Nodes[j].ID })
+	sort.Slice(gr.Edges, func(i, j int) bool {
+		if gr.Edges[i].From != gr.Edges[j].From {
+			return gr.Edges[i].From < gr.Edges[j].From
+		}
+		return gr.Edges[i].Field < gr.Edges[j].Field
+	})
+	return gr
+}
+
+// Format renders the graph as dot, mermaid or json.
+func (gr *Graph) Format(format string) (string, error) {
+	switch format {
+	case GraphDOT:
+		return gr.DOT(), nil
+	case GraphMermaid:
+		return gr.Mermaid(), nil
+	case GraphJSON:
+		data, err := json.MarshalIndent(gr, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+	return "", fmt.Errorf("unknown graph format %q, want dot, mermaid or json", format)
+}
+
+// DOT renders the graph in Graphviz DOT.
+func (gr *Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph sandwich {\n\trankdir=LR;\n")
+	for _, n := range gr.Nodes {
+		attrs := "shape=box"
+		switch n.Kind {
+		case NodeProxy:
+			attrs = "shape=box, style=bold"
+		case NodeValue:
+			attrs = "shape=note"
+		case NodeUnresolved:
+			attrs = "shape=box, style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%q [label=%q, %s];\n", n.ID, strings.Join(n.lines(), "\n"), attrs)
+	}
+	for _, e := range gr.Edges {
+		style := ""
+		if e.Kind == EdgeValue {
+			style = ", style=dotted"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q%s];\n", e.From, e.To, e.Field, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a mermaid flowchart.
+func (gr *Graph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	ids := map[string]string{}
+	for i, n := range gr.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ID] = id
+		label := mermaidEscape(strings.Join(n.lines(), "<br/>"))
+		switch n.Kind {
+		case NodeProxy:
+			fmt.Fprintf(&b, "\t%s[[\"%s\"]]\n", id, label)
+		case NodeValue:
+			fmt.Fprintf(&b, "\t%s>\"%s\"]\n", id, label)
+		default:
+			fmt.Fprintf(&b, "\t%s[\"%s\"]\n", id, label)
+		}
+	}
+	for _, e := range gr.Edges {
+		arrow := "-->"
+		if e.Kind == EdgeValue {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "\t%s %s|%s| %s\n", ids[e.From], arrow, mermaidEscape(e.Field), ids[e.To])
+	}
+	return b.String()
+}
+
+// lines is the label of the node, short name first.
+func (n GraphNode) lines() []string {
+	switch n.Kind {
+	case NodeValue:
+		return []string{n.Value}
+	case NodeUnresolved:
+		return []string{path.Base(n.ID), "unresolved"}
+	}
+	factory := path.Base(n.Package) + "." + n.Factory + "()"
+	if n.Singleton {
+		factory += " singleton"
+	}
+	return []string{path.Base(n.ID), factory}
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
@@ -1,72 +1,98 @@
 package gen
 
 import (
-	"fmt"
+	"bufio"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/pmezard/go-difflib/difflib"
 	"golang.org/x/tools/go/packages"
 )
 
-func getAllPathPatterns(patterns []string) []string {
+func getCurrentPkg(dir string) string {
+	pkgs, _ := packages.Load(&packages.Config{Dir: dir}, ".")
+	return pkgs[0].String()
+}
+
+func filterEmptyStr(ss ...string) []string {
+	arr := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if len(s) > 0 {
+			arr = append(arr, s)
+		}
+	}
+	return arr
+}
+
+// getGeneratedFiles lists go files in dir carrying the sandwich generated header.
+func getGeneratedFiles(dir string) []string {
 	var list []string
-	for _, v := range patterns {
-		_ = filepath.Walk(v, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				fmt.Println(err)
-				return nil
-			}
-			if info.IsDir() {
-				list = append(list, strings.Join([]string{".", path}, string(filepath.Separator)))
-			}
-			return nil
-		})
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, name := range matches {
+		if isGeneratedFile(name) {
+			list = append(list, name)
+		}
 	}
 	return list
 }
 
-func getCurrentPkg() string {
-	pkgs, _ := packages.Load(&packages.Config{}, ".")
-	return pkgs[0].String()
+func isGeneratedFile(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return hasGeneratedHeader(f)
 }
 
-func getRelevantPkg(current, target string) (s string) {
-	// target deep than current, trim current
-	if strings.HasPrefix(target, current) {
-		s = strings.TrimPrefix(target, current)
-	} else {
-		var prefix string
-		list := strings.Split(current, string(filepath.Separator))
-		// current deep than targe, get layer
-		for _, p := range strings.Split(target, string(filepath.Separator)) {
-			prepre := prefix
-
-			prefix = filepath.Join(prefix, p)
-			if !strings.HasPrefix(current, prefix) {
-				prefix = prepre
-				break
-			}
-			list = list[1:]
-		}
-		if len(prefix) == 0 {
-			return ""
-		}
-		s = strings.TrimPrefix(target, prefix)
-		for range list {
-			s = filepath.Join("..", s)
+// hasGeneratedHeader reports whether the first non-empty line is the generated header.
+func hasGeneratedHeader(r io.Reader) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
 		}
+		return line == astutils.GeneratedHeader
 	}
-	s = filepath.Join(".", s)
-	return
+	return false
 }
 
-func filterEmptyStr(ss ...string) []string {
-	arr := make([]string, 0, len(ss))
-	for _, s := range ss {
-		if len(s) > 0 {
-			arr = append(arr, s)
-		}
+func unifiedDiff(name string, old, new []byte) string {
+	fromFile, toFile := name, name
+	if old == nil {
+		fromFile = os.DevNull
 	}
-	return arr
+	if new == nil {
+		toFile = os.DevNull
+	}
+	text, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(old),
+		B:        splitLines(new),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+	if len(text) > 0 && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text
+}
+
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
 }
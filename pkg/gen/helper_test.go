@@ -1,32 +1,47 @@
 package gen
 
 import (
-	"reflect"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func Test_getAllPathPatterns(t *testing.T) {
-	type args struct {
-		patterns []string
-	}
-	tests := []struct {
-		name string
-		args args
-		want []string
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := getAllPathPatterns(tt.args.patterns); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("getAllPathPatterns() = %v, want %v", got, tt.want)
-			}
-		})
+func Test_discoverPatterns(t *testing.T) {
+	t.Setenv("GOWORK", "")
+	dir := t.TempDir()
+	for _, name := range []string{
+		"go.mod", "main.go", "a/a.go", "a/testdata/t.go", "a/mocks/m.go", "a/b/b_test.go", "a/b/c/c.go",
+		"vendor/v/v.go", ".git/g.go", "_tmp/t.go", "legacy/l.go", "nested/go.mod", "nested/n.go",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("package x\n"), 0o644))
 	}
+	sep := string(filepath.Separator)
+	assert.Equal(t, []string{".", "." + sep + "a", "." + sep + filepath.Join("a", "b", "c"), "example.com/x"},
+		discoverPatterns(dir, []string{"./...", "example.com/x"}, []string{"mocks", "legacy"}, false))
+	assert.Equal(t, []string{"." + sep + "a", "." + sep + filepath.Join("a", "b", "c"), "." + sep + "legacy", "fmt"},
+		discoverPatterns(dir, []string{"./a", "./legacy", "fmt"}, []string{"a/mocks"}, true))
+	assert.Equal(t, []string{"./a"}, discoverPatterns(dir, []string{"./a"}, nil, false))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.work"), []byte("go 1.22\n\nuse (\n\t.\n\t./nested\n)\n"), 0o644))
+	assert.Contains(t, discoverPatterns(dir, []string{"./..."}, nil, false), "."+sep+"nested")
 }
 
 func Test_getCurrentPkg(t *testing.T) {
-	assert.Equal(t, "github.com/go-park/sandwich/pkg/gen", getCurrentPkg())
+	assert.Equal(t, "github.com/go-park/sandwich/pkg/gen", getCurrentPkg(""))
+}
+
+func Test_getGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"foo_proxy.gen.go": "\n// Code generated by sandwich. DO NOT EDIT.\n\npackage main\n",
+		"foo.go":           "package main\n",
+		"bar_string.go":    "// Code generated by \"stringer\"; DO NOT EDIT.\n\npackage main\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	assert.Equal(t, []string{filepath.Join(dir, "foo_proxy.gen.go")}, getGeneratedFiles(dir))
 }
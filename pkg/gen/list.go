@@ -0,0 +1,133 @@
+package gen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+type (
+	// Listing is what the generator found in the parsed packages.
+	Listing struct {
+		Proxies    []ListedProxy     `json:"proxies"`
+		Aspects    []ListedAspect    `json:"aspects"`
+		Components []ListedComponent `json:"components"`
+	}
+	ListedProxy struct {
+		Name      string   `json:"name"` // package path and name of the proxied struct
+		Abstract  string   `json:"abstract,omitempty"`
+		Singleton bool     `json:"singleton"`
+		Output    string   `json:"output,omitempty"` // generated file, empty for packages out of the project
+		Methods   []string `json:"methods"`          // methods with pointcuts
+		Pos       string   `json:"pos"`
+	}
+	ListedAspect struct {
+		Name        string   `json:"name"`
+		Aliases     []string `json:"aliases,omitempty"`
+		Annotations []string `json:"annotations,omitempty"`
+		Advice      []string `json:"advice"` // before, after and around
+	}
+	ListedComponent struct {
+		Name    string `json:"name"`
+		Factory string `json:"factory"`
+	}
+)
+
+// List returns proxies, aspects and components of the parsed packages, sorted by name.
+func (g *Generator) List() *Listing {
+	g.inspect()
+	l := &Listing{
+		Proxies:    []ListedProxy{},
+		Aspects:    []ListedAspect{},
+		Components: []ListedComponent{},
+	}
+	for k, proxy := range g.proxyCache {
+		p := ListedProxy{
+			Name:      proxy.PkgPath() + "." + proxy.Name(),
+			Abstract:  proxy.Abstract(),
+			Singleton: proxy.IsSingleton(),
+			Methods:   []string{},
+			Pos:       relPosition(g.fset.Position(k.Pos())),
+		}
+		if pkg, ok := g.pkgList[proxy.PkgPath()]; ok {
+			if targetDir, ok := g.targetDir(pkg); ok {
+				p.Output = absPath(g.outputPath(pkg, targetDir, proxy.Name()))
+			}
+		}
+		for _, m := range proxy.GetMethods() {
+			p.Methods = append(p.Methods, m.Name())
+		}
+		sort.Strings(p.Methods)
+		l.Proxies = append(l.Proxies, p)
+	}
+	aliases := map[string][]string{}
+	for alias, full := range g.aspectAlias {
+		aliases[full] = append(aliases[full], alias)
+	}
+	annotations := map[string][]string{}
+	for anno, full := range g.aspectCustoms {
+		annotations[full] = append(annotations[full], anno.String())
+	}
+	for name, a := range g.aspectCache {
+		la := ListedAspect{
+			Name:        name,
+			Aliases:     aliases[name],
+			Annotations: annotations[name],
+			Advice:      []string{},
+		}
+		sort.Strings(la.Aliases)
+		sort.Strings(la.Annotations)
+		if hasAdvice(a.GetBefore()) {
+			la.Advice = append(la.Advice, "before")
+		}
+		if hasAdvice(a.GetAfter()) {
+			la.Advice = append(la.Advice, "after")
+		}
+		if hasAdvice(a.GetAround()) {
+			la.Advice = append(la.Advice, "around")
+		}
+		l.Aspects = append(l.Aspects, la)
+	}
+	for name, comp := range g.componentCache {
+		facPkg, _, facName := comp.Factory()
+		l.Components = append(l.Components, ListedComponent{Name: name, Factory: facPkg + "." + facName})
+	}
+	sort.Slice(l.Proxies, func(i, j int) bool { return l.Proxies[i].Name < l.Proxies[j].Name })
+	sort.Slice(l.Aspects, func(i, j int) bool { return l.Aspects[i].Name < l.Aspects[j].Name })
+	sort.Slice(l.Components, func(i, j int) bool { return l.Components[i].Name < l.Components[j].Name })
+	return l
+}
+
+func (l *Listing) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "proxies:\n")
+	for _, v := range l.Proxies {
+		fmt.Fprintf(&b, "  %s %s\n", v.Name, v.Pos)
+		if len(v.Methods) > 0 {
+			fmt.Fprintf(&b, "    methods: %s\n", strings.Join(v.Methods, ", "))
+		}
+		if len(v.Output) > 0 {
+			fmt.Fprintf(&b, "    output: %s\n", relPath(v.Output))
+		}
+	}
+	fmt.Fprintf(&b, "aspects:\n")
+	for _, v := range l.Aspects {
+		names := append(append([]string{}, v.Aliases...), v.Annotations...)
+		if len(names) > 0 {
+			fmt.Fprintf(&b, "  %s (%s) %s\n", v.Name, strings.Join(names, ", "), strings.Join(v.Advice, ", "))
+		} else {
+			fmt.Fprintf(&b, "  %s %s\n", v.Name, strings.Join(v.Advice, ", "))
+		}
+	}
+	fmt.Fprintf(&b, "components:\n")
+	for _, v := range l.Components {
+		fmt.Fprintf(&b, "  %s %s()\n", v.Name, v.Factory)
+	}
+	return b.String()
+}
+
+func hasAdvice(advice aspect.Advice) bool {
+	return advice != nil && advice.Func() != nil
+}
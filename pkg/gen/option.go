@@ -1,11 +1,37 @@
 package gen
 
+import (
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
 type (
 	options struct {
-		patterns  []string
-		tags      []string
-		recursive bool
-		deps      []string
+		patterns   []string
+		ignore     []string
+		tags       []string
+		recursive  bool
+		deps       []string
+		check      bool
+		diff       bool
+		suffix     string
+		outputName string
+		outputDir  string
+		singleton  bool
+		adviceMode aspect.AdviceMode
+		extensions []string
+		syntax     astutils.AnnotationSyntax
+		// templateFile is the proxy template of the project, relative to dir
+		templateFile string
+		configFile   string
+		configErr    error
+		prune        bool
+		dryRun       bool
+		useCache     bool
+		cacheDir     string
+		dir          string
+		overlay      map[string][]byte
+		plugins      []Plugin
 	}
 	Option     interface{ apply(*options) }
 	optionFunc func(g *options)
@@ -17,10 +43,16 @@ func (f optionFunc) apply(o *options) {
 
 func DefaultOptions() options {
 	return options{
-		patterns:  []string{"."},
-		tags:      []string{},
-		deps:      []string{},
-		recursive: true,
+		patterns:   []string{"."},
+		tags:       []string{},
+		deps:       []string{},
+		recursive:  true,
+		suffix:     astutils.DefaultProxySuffix,
+		adviceMode: aspect.ModeInline,
+		outputName: DefaultOutputName,
+		syntax:     astutils.SyntaxBoth,
+		prune:      true,
+		useCache:   true,
 	}
 }
 
@@ -34,6 +66,14 @@ func WithPatterns(patterns ...string) Option {
 		})
 }
 
+// WithIgnore skips directories matching the patterns when discovering packages, see Config.Ignore.
+func WithIgnore(patterns ...string) Option {
+	return optionFunc(
+		func(o *options) {
+			o.ignore = append(o.ignore, filterEmptyStr(patterns...)...)
+		})
+}
+
 func WithTags(tags ...string) Option {
 	return optionFunc(
 		func(o *options) {
@@ -60,3 +100,177 @@ func WithDeps(deps ...string) Option {
 			}
 		})
 }
+
+// WithCheck compares generated files against disk instead of writing them.
+func WithCheck(check bool) Option {
+	return optionFunc(
+		func(o *options) {
+			o.check = o.check || check
+		})
+}
+
+// WithDiff enables check mode and records a unified diff for each stale file, see Generator.Diffs.
+func WithDiff(diff bool) Option {
+	return optionFunc(
+		func(o *options) {
+			if diff {
+				o.check = true
+				o.diff = true
+			}
+		})
+}
+
+// WithConfigFile applies a sandwich.yaml or sandwich.json config file,
+// options following it override the values of the file.
+func WithConfigFile(path string) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(path) == 0 {
+				return
+			}
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				o.configErr = err
+				return
+			}
+			o.configFile = path
+			cfg.apply(o)
+		})
+}
+
+// WithSuffix sets the default proxy suffix for @Proxy without suffix=.
+func WithSuffix(suffix string) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(suffix) > 0 {
+				o.suffix = suffix
+			}
+		})
+}
+
+// WithOutputName sets the template of generated file names, see DefaultOutputName.
+func WithOutputName(name string) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(name) > 0 {
+				o.outputName = name
+			}
+		})
+}
+
+// WithOutputDir writes generated files under dir, mirroring the package layout.
+func WithOutputDir(dir string) Option {
+	return optionFunc(
+		func(o *options) {
+			o.outputDir = dir
+		})
+}
+
+// WithSingleton sets the default factory mode for @Proxy without singleton=.
+func WithSingleton(singleton bool) Option {
+	return optionFunc(
+		func(o *options) {
+			o.singleton = singleton
+		})
+}
+
+// WithAdviceMode sets how advice of @Aspect without mode= is woven, inline by default.
+func WithAdviceMode(mode aspect.AdviceMode) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(mode) > 0 {
+				o.adviceMode = mode
+			}
+		})
+}
+
+// WithExtensions enables registered extensions by name, all are enabled by default.
+func WithExtensions(names ...string) Option {
+	return optionFunc(
+		func(o *options) {
+			names = filterEmptyStr(names...)
+			if len(names) > 0 {
+				o.extensions = names
+			}
+		})
+}
+
+// WithAnnotationSyntax accepts @Annotation comments, //sandwich: directives or both, default both.
+func WithAnnotationSyntax(syntax astutils.AnnotationSyntax) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(syntax) > 0 {
+				o.syntax = syntax
+			}
+		})
+}
+
+// WithTemplate renders proxies by the template file at path instead of the default one,
+// @Proxy with template= overrides it.
+func WithTemplate(path string) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(path) > 0 {
+				o.templateFile = path
+			}
+		})
+}
+
+// WithPlugins adds plugins to the generator, after those of RegisterPlugin.
+func WithPlugins(plugins ...Plugin) Option {
+	return optionFunc(
+		func(o *options) {
+			o.plugins = append(o.plugins, plugins...)
+		})
+}
+
+// WithPrune removes generated files which no longer belong to any proxy on Output, default true.
+func WithPrune(prune bool) Option {
+	return optionFunc(
+		func(o *options) {
+			o.prune = prune
+		})
+}
+
+// WithDryRun lists orphaned generated files in Generator.Removed instead of removing them.
+func WithDryRun(dryRun bool) Option {
+	return optionFunc(
+		func(o *options) {
+			o.dryRun = o.dryRun || dryRun
+		})
+}
+
+// WithCache skips rendering proxies whose inputs are unchanged since the last run, default true.
+func WithCache(useCache bool) Option {
+	return optionFunc(
+		func(o *options) {
+			o.useCache = useCache
+		})
+}
+
+// WithCacheDir stores the cache under dir instead of the user cache directory.
+func WithCacheDir(dir string) Option {
+	return optionFunc(
+		func(o *options) {
+			if len(dir) > 0 {
+				o.cacheDir = dir
+			}
+		})
+}
+
+// WithDir loads packages, resolves patterns and writes output relative to dir instead of the working directory.
+func WithDir(dir string) Option {
+	return optionFunc(
+		func(o *options) {
+			o.dir = dir
+		})
+}
+
+// WithOverlay replaces the content of source files, keyed by absolute path,
+// files which do not exist on disk are added to their directory's package.
+func WithOverlay(overlay map[string][]byte) Option {
+	return optionFunc(
+		func(o *options) {
+			o.overlay = overlay
+		})
+}
@@ -0,0 +1,180 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+type (
+	// Plugin extends generation, it implements any of the hook interfaces below.
+	// Hooks are called in registration order, an error is reported as a diagnostic of the plugin.
+	// The cache of unchanged proxies is disabled while plugins are in use,
+	// so that hooks see every proxy on every run.
+	Plugin interface {
+		Name() string
+	}
+	// AfterParseHook is called once all packages are inspected, before any proxy is rendered.
+	AfterParseHook interface {
+		AfterParse(ctx *PluginContext) error
+	}
+	// AspectHook is called when a pointcut name is resolved, it may replace the aspect.
+	AspectHook interface {
+		ResolveAspect(ctx *PluginContext, name string, a aspect.Aspect, ok bool) (aspect.Aspect, bool)
+	}
+	// MethodHook is called for every advised method once its advice is woven.
+	MethodHook interface {
+		Method(ctx *PluginContext, proxy aspect.Proxy, method aspect.Method, m *astutils.ProxyMethod) error
+	}
+	// BeforeRenderHook is called with the data of a proxy before it is rendered, data may be changed.
+	BeforeRenderHook interface {
+		BeforeRender(ctx *PluginContext, proxy aspect.Proxy, data *astutils.ProxyData) error
+	}
+	// AfterFormatHook is called for every formatted file, proxies and emitted files, and returns its final content.
+	AfterFormatHook interface {
+		AfterFormat(ctx *PluginContext, path string, src []byte) ([]byte, error)
+	}
+
+	// PluginContext gives plugins access to the state of the generator.
+	PluginContext struct {
+		g *Generator
+	}
+)
+
+var registeredPlugins []Plugin
+
+// RegisterPlugin adds plugins to every generator, see WithPlugins for a single one.
+func RegisterPlugin(list ...Plugin) {
+	registeredPlugins = append(registeredPlugins, list...)
+}
+
+func (g *Generator) activePlugins() []Plugin {
+	return append(append([]Plugin{}, registeredPlugins...), g.plugins...)
+}
+
+// Proxies returns parsed proxies sorted by package path and name.
+func (c *PluginContext) Proxies() []aspect.Proxy {
+	var list []aspect.Proxy
+	for k, p := range c.g.proxyCache {
+		if k.IsExported() {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].PkgPath() != list[j].PkgPath() {
+			return list[i].PkgPath() < list[j].PkgPath()
+		}
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// Aspects returns parsed aspects by full name.
+func (c *PluginContext) Aspects() map[string]aspect.Aspect {
+	return c.g.aspectCache
+}
+
+// Components returns injectable components by name.
+func (c *PluginContext) Components() map[string]aspect.Component {
+	return c.g.componentCache
+}
+
+// Package returns the parsed package of path, or nil.
+func (c *PluginContext) Package(path string) *astutils.Package {
+	return c.g.pkgList[path]
+}
+
+// Fset returns positions of the parsed packages.
+func (c *PluginContext) Fset() *token.FileSet {
+	return c.g.fset
+}
+
+// Diagnostics collects problems reported by plugins.
+func (c *PluginContext) Diagnostics() *astutils.Diagnostics {
+	return c.g.diagnostics
+}
+
+// Emit adds a file named name to the output directory of the package path. It is written,
+// checked and pruned like proxies, go files are formatted and must start with astutils.GeneratedHeader.
+func (c *PluginContext) Emit(path, name string, src []byte) error {
+	pkg, ok := c.g.pkgList[path]
+	if !ok {
+		return fmt.Errorf("emit %s: unknown package %s", name, path)
+	}
+	targetDir, ok := c.g.targetDir(pkg)
+	if !ok {
+		return fmt.Errorf("emit %s: package %s is not generated", name, path)
+	}
+	c.g.emitted[filepath.Join(targetDir, name)] = src
+	return nil
+}
+
+func (g *Generator) pluginContext() *PluginContext {
+	return &PluginContext{g: g}
+}
+
+func (g *Generator) reportPlugin(pos token.Pos, p Plugin, err error) {
+	g.diagnostics.Errorf(pos, astutils.CodePlugin, "plugin %s: %v", p.Name(), err)
+}
+
+func (g *Generator) afterParse() {
+	for _, p := range g.activePlugins() {
+		if h, ok := p.(AfterParseHook); ok {
+			if err := h.AfterParse(g.pluginContext()); err != nil {
+				g.reportPlugin(token.NoPos, p, err)
+			}
+		}
+	}
+}
+
+func (g *Generator) pluginAspect(name string, a aspect.Aspect, ok bool) (aspect.Aspect, bool) {
+	for _, p := range g.activePlugins() {
+		if h, is := p.(AspectHook); is {
+			a, ok = h.ResolveAspect(g.pluginContext(), name, a, ok)
+		}
+	}
+	return a, ok
+}
+
+func (g *Generator) pluginMethod(proxy aspect.Proxy, method aspect.Method, m *astutils.ProxyMethod) {
+	for _, p := range g.activePlugins() {
+		if h, ok := p.(MethodHook); ok {
+			if err := h.Method(g.pluginContext(), proxy, method, m); err != nil {
+				pos := token.NoPos
+				if method.Func() != nil {
+					pos = method.Func().Pos()
+				}
+				g.reportPlugin(pos, p, err)
+			}
+		}
+	}
+}
+
+func (g *Generator) beforeRender(k *ast.Ident, proxy aspect.Proxy, pd *astutils.ProxyData) {
+	for _, p := range g.activePlugins() {
+		if h, ok := p.(BeforeRenderHook); ok {
+			if err := h.BeforeRender(g.pluginContext(), proxy, pd); err != nil {
+				g.reportPlugin(k.Pos(), p, err)
+			}
+		}
+	}
+}
+
+func (g *Generator) afterFormat(pos token.Pos, path string, src []byte) []byte {
+	for _, p := range g.activePlugins() {
+		if h, ok := p.(AfterFormatHook); ok {
+			out, err := h.AfterFormat(g.pluginContext(), path, src)
+			if err != nil {
+				g.reportPlugin(pos, p, err)
+				continue
+			}
+			src = out
+		}
+	}
+	return src
+}
@@ -0,0 +1,230 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+// AspectBuildTag excludes aspects from the build of the project, the generator loads them with -tags=sandwich.
+const AspectBuildTag = "sandwich"
+
+type (
+	// AspectScaffold describes an aspect file written by aspect new aspect.
+	AspectScaffold struct {
+		Package string
+		// Name is the alias of the aspect, the struct is Aspect followed by the title of Name
+		Name string
+		// Custom is an annotation, without @, which is a pointcut of the aspect
+		Custom string
+		Before bool
+		After  bool
+		Around bool
+		Syntax astutils.AnnotationSyntax
+	}
+	// ProxyScaffold describes a proxied struct file written by aspect new proxy.
+	ProxyScaffold struct {
+		Package  string
+		Type     string
+		Abstract string
+		// Pointcut of the stub method, none if empty
+		Pointcut string
+		Syntax   astutils.AnnotationSyntax
+	}
+)
+
+var scaffoldAspectTpl = template.Must(template.New("aspect").Funcs(scaffoldFuncs).Parse(
+	`//go:build ` + AspectBuildTag + `
+// +build ` + AspectBuildTag + `
+
+package {{ .Package }}
+
+import (
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+{{ anno "Aspect" (quote .Name) (param "custom" .Custom) }}
+type {{ .Struct }} struct{}
+{{- if .Before }}
+
+{{ anno "Before" }}
+func (a *{{ .Struct }}) Before(jp aspect.Joinpoint) {
+}
+{{- end }}
+{{- if .After }}
+
+{{ anno "After" }}
+func (a *{{ .Struct }}) After(jp aspect.Joinpoint) {
+}
+{{- end }}
+{{- if .Around }}
+
+{{ anno "Around" }}
+func (a *{{ .Struct }}) Around(pjp aspect.ProceedingJoinpoint) []any {
+	result := pjp.Proceed()
+	return result
+}
+{{- end }}
+`))
+
+var scaffoldProxyTpl = template.Must(template.New("proxy").Funcs(scaffoldFuncs).Parse(
+	`package {{ .Package }}
+
+import (
+	"context"
+)
+
+var _ {{ .Abstract }} = &{{ .Type }}{}
+
+{{ anno "Proxy" (quote .Abstract) }}
+type {{ .Type }} struct{}
+
+type {{ .Abstract }} interface {
+	Do(ctx context.Context) error
+}
+{{ if .Pointcut }}
+{{ anno "Pointcut" (quote .Pointcut) }}
+{{- end }}
+func (s *{{ .Type }}) Do(ctx context.Context) error {
+	return nil
+}
+`))
+
+var scaffoldFuncs = template.FuncMap{
+	"quote": func(s string) string { return `"` + s + `"` },
+	"param": func(k, v string) string {
+		if len(v) == 0 {
+			return ""
+		}
+		return k + `="` + v + `"`
+	},
+	// replaced by the syntax of the scaffold before executing
+	"anno": func(name string, params ...string) string { return "" },
+}
+
+// annotationFunc writes annotations as //@Name("value", key="value") or as
+// //sandwich:name value key=value directives.
+func annotationFunc(syntax astutils.AnnotationSyntax) func(name string, params ...string) string {
+	return func(name string, params ...string) string {
+		var list []string
+		for _, v := range params {
+			if len(v) > 0 {
+				list = append(list, v)
+			}
+		}
+		if syntax == astutils.SyntaxDirective {
+			line := "//" + astutils.DirectivePrefix + strings.ToLower(name[:1]) + name[1:]
+			for _, v := range list {
+				line += " " + strings.ReplaceAll(v, `"`, "")
+			}
+			return line
+		}
+		if len(list) == 0 {
+			return "//@" + name
+		}
+		return "//@" + name + "(" + strings.Join(list, ", ") + ")"
+	}
+}
+
+// ScaffoldAspect renders the file of a new aspect with the given advice, all advice if none is given.
+func ScaffoldAspect(s AspectScaffold) ([]byte, error) {
+	if !token.IsIdentifier(s.Name) {
+		return nil, fmt.Errorf("invalid aspect name %q", s.Name)
+	}
+	s.Custom = strings.TrimPrefix(s.Custom, "@")
+	if len(s.Custom) > 0 && !token.IsIdentifier(s.Custom) {
+		return nil, fmt.Errorf("invalid custom annotation %q", s.Custom)
+	}
+	if !s.Before && !s.After && !s.Around {
+		s.Before, s.After, s.Around = true, true, true
+	}
+	data := struct {
+		AspectScaffold
+		Struct string
+	}{s, "Aspect" + upperFirst(s.Name)}
+	return execScaffold(scaffoldAspectTpl, s.Syntax, data)
+}
+
+// ScaffoldProxy renders the file of a new proxied struct with its interface and a stub method.
+func ScaffoldProxy(s ProxyScaffold) ([]byte, error) {
+	if !token.IsIdentifier(s.Type) || !token.IsExported(s.Type) {
+		return nil, fmt.Errorf("invalid proxy type %q, want an exported name", s.Type)
+	}
+	if len(s.Abstract) == 0 {
+		s.Abstract = "I" + s.Type
+	}
+	if !token.IsIdentifier(s.Abstract) {
+		return nil, fmt.Errorf("invalid abstract %q", s.Abstract)
+	}
+	return execScaffold(scaffoldProxyTpl, s.Syntax, s)
+}
+
+func execScaffold(tpl *template.Template, syntax astutils.AnnotationSyntax, data any) ([]byte, error) {
+	tpl, err := tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Funcs(template.FuncMap{"anno": annotationFunc(syntax)}).Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	// not go/format, which rewrites //@Proxy to // @Proxy
+	if _, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), parser.ParseComments); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaffoldPackage returns the package name of the go files in dir, or a name derived from dir.
+func scaffoldPackage(dir string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, name := range matches {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "main"
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, filepath.Base(abs))
+	if !token.IsIdentifier(name) {
+		return "main"
+	}
+	return name
+}
+
+// writeScaffold writes src to path unless it exists.
+func writeScaffold(path string, src []byte, force bool) error {
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s exists, use -force to overwrite it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, src, 0o644)
+}
+
+func upperFirst(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,39 @@
+package gen
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaffold(t *testing.T) {
+	dir, err := filepath.Abs("../../examples")
+	assert.NoError(t, err)
+	for _, syntax := range []astutils.AnnotationSyntax{astutils.SyntaxComment, astutils.SyntaxDirective} {
+		a, err := ScaffoldAspect(AspectScaffold{Package: "aspect", Name: "audit", Custom: "@Audited", Before: true, Syntax: syntax})
+		assert.NoError(t, err)
+		p, err := ScaffoldProxy(ProxyScaffold{Package: "main", Type: "Order", Pointcut: "audit", Syntax: syntax})
+		assert.NoError(t, err)
+
+		r := NewGenerator(
+			WithDir(dir),
+			WithTags("sandwich"),
+			WithCache(false),
+			WithOverlay(map[string][]byte{
+				filepath.Join(dir, "aspect", "audit.go"): a,
+				filepath.Join(dir, "order.go"):           p,
+			}),
+		).ParsePackage().Generate().Format().Result()
+
+		assert.Empty(t, r.Diagnostics, syntax)
+		assert.Contains(t, string(r.Files[filepath.Join(dir, "order_proxy.gen.go")]),
+			"func (p *OrderProxy) Do(ctx context.Context) (r0 error) {", syntax)
+	}
+
+	_, err = ScaffoldAspect(AspectScaffold{Package: "aspect", Name: "au-dit"})
+	assert.EqualError(t, err, `invalid aspect name "au-dit"`)
+	_, err = ScaffoldProxy(ProxyScaffold{Package: "main", Type: "order"})
+	assert.EqualError(t, err, `invalid proxy type "order", want an exported name`)
+}
@@ -0,0 +1,192 @@
+package gen
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+)
+
+const (
+	DefaultWatchInterval = 500 * time.Millisecond
+	DefaultWatchDebounce = 300 * time.Millisecond
+)
+
+type (
+	// watchFile is the state of a watched go file at the last poll.
+	watchFile struct {
+		modTime  time.Time
+		size     int64
+		relevant bool // has sandwich annotations or belongs to a proxied package
+	}
+	watcher struct {
+		opts      []Option
+		report    func(g *Generator)
+		options   options
+		cache     *genCache           // kept across runs, in memory if the cache is disabled
+		dirs      map[string]struct{} // scanned package directories
+		pkgDirs   map[string]struct{} // directories of generated packages, like those of import paths
+		proxyDirs map[string]struct{} // directories holding proxied structs
+		files     map[string]watchFile
+	}
+)
+
+// Watch generates once, then polls the package directories of the patterns every interval and
+// generates again when a go file with sandwich annotations, or of a proxied package, changes.
+// Directories are discovered again on every poll. Changes are debounced until no file changed
+// for debounce, then only the affected packages are loaded again. report, if not nil, is called
+// with the generator of every run to print its diagnostics and errors, errors of later runs never
+// stop watching. Watch returns the error of the first run, or nil when ctx is done.
+func Watch(ctx context.Context, interval, debounce time.Duration, report func(g *Generator), opts ...Option) error {
+	w := &watcher{opts: opts, report: report, options: DefaultOptions()}
+	for _, opt := range opts {
+		opt.apply(&w.options)
+	}
+	if err := w.run(); err != nil {
+		return err
+	}
+	var pending time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if changed := w.poll(); len(changed) > 0 {
+			log.Printf("changed %s", strings.Join(changed, ", "))
+			pending = time.Now()
+			continue
+		}
+		if !pending.IsZero() && time.Since(pending) >= debounce {
+			pending = time.Time{}
+			w.run()
+		}
+	}
+}
+
+// run executes the pipeline, packages unchanged since the last run are not loaded again
+// and the cache restricts rendering and writing to affected proxies.
+func (w *watcher) run() error {
+	start := time.Now()
+	g := NewGenerator(w.opts...)
+	if w.cache == nil {
+		w.cache = g.cache
+	}
+	w.cache.fileSums = map[string]string{}
+	g.cache, g.useCache = w.cache, true
+	g.ParsePackage().Generate().Format().Output()
+	if w.report != nil {
+		w.report(g)
+	}
+	w.pkgDirs = map[string]struct{}{}
+	w.proxyDirs = map[string]struct{}{}
+	for _, pkg := range g.pkgList {
+		if _, ok := g.targetDir(pkg); !ok {
+			continue
+		}
+		dir := filepath.Dir(pkg.AstPkg.GoFiles[0])
+		w.pkgDirs[dir] = struct{}{}
+		if len(pkg.FileBuf) > 0 {
+			w.proxyDirs[dir] = struct{}{}
+		}
+	}
+	for dir, e := range g.skipped {
+		w.pkgDirs[dir] = struct{}{}
+		if len(e.Outputs) > 0 {
+			w.proxyDirs[dir] = struct{}{}
+		}
+	}
+	// own writes must not trigger another run
+	w.files = w.snapshot()
+	if err := g.Err(); err != nil {
+		return err
+	}
+	log.Printf("generated in %s, watching %d package(s)", time.Since(start).Round(time.Millisecond), len(w.dirs))
+	return nil
+}
+
+// scan discovers the package directories of the patterns, which may have been created since the last scan.
+func (w *watcher) scan() {
+	root := absPath(w.options.dir)
+	w.dirs = map[string]struct{}{}
+	for dir := range w.pkgDirs {
+		w.dirs[dir] = struct{}{}
+	}
+	for _, p := range discoverPatterns(root, w.options.patterns, w.options.ignore, w.options.recursive) {
+		if !isDirPattern(p) {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(root, p)
+		}
+		w.dirs[filepath.Clean(p)] = struct{}{}
+	}
+}
+
+// poll returns relevant files changed, added or removed since the last poll.
+func (w *watcher) poll() []string {
+	files := w.snapshot()
+	var changed []string
+	for name, f := range files {
+		old, ok := w.files[name]
+		if ok && old.modTime.Equal(f.modTime) && old.size == f.size {
+			f.relevant = old.relevant
+			files[name] = f
+			continue
+		}
+		f.relevant = w.isRelevant(name)
+		files[name] = f
+		if f.relevant || old.relevant {
+			changed = append(changed, name)
+		}
+	}
+	for name, old := range w.files {
+		if _, ok := files[name]; !ok && old.relevant {
+			changed = append(changed, name)
+		}
+	}
+	w.files = files
+	return changed
+}
+
+func (w *watcher) snapshot() map[string]watchFile {
+	w.scan()
+	files := map[string]watchFile{}
+	for dir := range w.dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, name := range matches {
+			info, err := os.Stat(name)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			f := watchFile{modTime: info.ModTime(), size: info.Size()}
+			if old, ok := w.files[name]; ok {
+				f.relevant = old.relevant
+			} else {
+				f.relevant = w.isRelevant(name)
+			}
+			files[name] = f
+		}
+	}
+	return files
+}
+
+func (w *watcher) isRelevant(name string) bool {
+	if isGeneratedFile(name) {
+		return false
+	}
+	if _, ok := w.proxyDirs[filepath.Dir(name)]; ok {
+		return true
+	}
+	src, err := os.ReadFile(name)
+	if err != nil {
+		return false
+	}
+	return astutils.HasAnnotation(src)
+}
@@ -0,0 +1,61 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := copyExamples(t)
+	var stdout, stderr bytes.Buffer
+	c := newCLI(&stdout, &stderr)
+	w := &watcher{opts: []Option{WithDir(dir), WithTags("sandwich"), WithCache(false)}}
+	w.report = func(g *Generator) { c.report(g) }
+	w.options = DefaultOptions()
+	for _, opt := range w.opts {
+		opt.apply(&w.options)
+	}
+	assert.NoError(t, w.run())
+	barProxy := filepath.Join(dir, "bar_proxy.gen.go")
+	assert.FileExists(t, barProxy)
+	assert.Empty(t, w.poll())
+
+	// directories created after the first run are polled
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "baz"), 0o755))
+	baz := filepath.Join(dir, "baz", "baz.go")
+	assert.NoError(t, os.WriteFile(baz, []byte("package baz\n\n//@Proxy\ntype Baz struct{}\n\nfunc (b *Baz) Baz() {}\n"), 0o644))
+	assert.Equal(t, []string{baz}, w.poll())
+	assert.NoError(t, w.run())
+	assert.FileExists(t, filepath.Join(dir, "baz", "baz_proxy.gen.go"))
+
+	// a file broken mid-edit keeps its proxy
+	bar := filepath.Join(dir, "bar.go")
+	assert.NoError(t, os.WriteFile(bar, []byte("package main\n\ntype Bar struct {\n"), 0o644))
+	assert.Equal(t, []string{bar}, w.poll())
+	assert.NoError(t, w.run())
+	assert.FileExists(t, barProxy)
+	assert.Contains(t, stderr.String(), "bar.go:3:19: error: expected '}'")
+
+	// diagnostics are reported as json if requested
+	c.json = true
+	stdout.Reset()
+	assert.NoError(t, w.run())
+	var report struct {
+		Diagnostics []struct {
+			Message string `json:"message"`
+		} `json:"diagnostics"`
+	}
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.NotEmpty(t, report.Diagnostics)
+	c.json = false
+
+	// errors of later runs are returned
+	w.opts = append(w.opts, WithAdviceMode("compiled"))
+	assert.EqualError(t, w.run(), `loading config: unknown advice mode "compiled", want inline or call`)
+	assert.Contains(t, stderr.String(), `unknown advice mode "compiled"`)
+}
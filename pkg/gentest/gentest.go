@@ -0,0 +1,233 @@
+// Package gentest runs the generator against fixture packages and compares
+// the generated proxies with golden files, for authors of aspects and interceptors.
+//
+// A fixture is a directory holding a package, or a module with its own go.mod,
+// annotated the way a project would be. Each generated file is compared with
+// the file of the same name plus ".golden" in the fixture, diagnostics with
+// "diagnostics.golden" and, when executed, the output of go run with "stdout.golden".
+// Run go test with -update to write the golden files instead.
+//
+//	func TestLogAspect(t *testing.T) {
+//		astutils.RegisterFieldInterceptors(ValueInterceptor)
+//		gentest.Run(t, "testdata/log_aspect", gentest.Exec())
+//	}
+package gentest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/astutils"
+	"github.com/go-park/sandwich/pkg/gen"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	GoldenSuffix      = ".golden"
+	DiagnosticsGolden = "diagnostics.golden"
+	StdoutGolden      = "stdout.golden"
+)
+
+var update = flag.Bool("update", false, "update golden files of gentest fixtures")
+
+type (
+	config struct {
+		tags    []string
+		opts    []gen.Option
+		compile bool
+		exec    bool
+		args    []string
+	}
+	Option func(*config)
+)
+
+// WithTags sets build tags of generation, default sandwich.
+func WithTags(tags ...string) Option {
+	return func(c *config) {
+		c.tags = tags
+	}
+}
+
+// WithOptions passes additional options to the generator.
+func WithOptions(opts ...gen.Option) Option {
+	return func(c *config) {
+		c.opts = append(c.opts, opts...)
+	}
+}
+
+// NoCompile skips building the fixture with the generated files.
+func NoCompile() Option {
+	return func(c *config) {
+		c.compile = false
+	}
+}
+
+// Exec runs the main package of the fixture with the generated files and
+// compares its standard output with stdout.golden.
+func Exec(args ...string) Option {
+	return func(c *config) {
+		c.exec = true
+		c.args = args
+	}
+}
+
+// Run generates proxies of the fixture in dir in memory, compares them with golden
+// files, then compiles and optionally executes the fixture with the generated files.
+// Nothing is written into the fixture unless -update is set.
+func Run(t testing.TB, dir string, opts ...Option) {
+	t.Helper()
+	c := &config{tags: []string{"sandwich"}, compile: true}
+	for _, opt := range opts {
+		opt(c)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genOpts := append([]gen.Option{
+		gen.WithDir(dir),
+		gen.WithPatterns("."),
+		gen.WithTags(c.tags...),
+		gen.WithCache(false),
+	}, c.opts...)
+	g := gen.NewGenerator(genOpts...).ParsePackage().Generate().Format()
+	if err := g.Err(); err != nil {
+		t.Fatal(err)
+	}
+	r := g.Result()
+
+	checkDiagnostics(t, dir, r.Diagnostics)
+	checkFiles(t, dir, r.Files)
+	if !c.compile && !c.exec {
+		return
+	}
+	overlay := writeOverlay(t, r.Files)
+	if c.compile {
+		goCmd(t, dir, "build", "-overlay="+overlay, "-o", os.DevNull, "./...")
+	}
+	if c.exec {
+		args := append([]string{"run", "-overlay=" + overlay, "."}, c.args...)
+		stdout := goCmd(t, dir, args...)
+		compareGolden(t, filepath.Join(dir, StdoutGolden), stdout)
+	}
+}
+
+func checkDiagnostics(t testing.TB, dir string, list []astutils.Diagnostic) {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, d := range list {
+		if rel, err := filepath.Rel(dir, d.Pos.Filename); err == nil && len(d.Pos.Filename) > 0 {
+			d.Pos.Filename = filepath.ToSlash(rel)
+		}
+		buf.WriteString(d.String() + "\n")
+	}
+	golden := filepath.Join(dir, DiagnosticsGolden)
+	if _, err := os.Stat(golden); err == nil || (*update && buf.Len() > 0) {
+		compareGolden(t, golden, buf.Bytes())
+		return
+	}
+	for _, d := range list {
+		if d.Severity == astutils.SeverityError {
+			t.Errorf("%s", d)
+		}
+	}
+}
+
+func checkFiles(t testing.TB, dir string, files map[string][]byte) {
+	t.Helper()
+	expected := map[string]struct{}{}
+	for name, src := range files {
+		golden := name + GoldenSuffix
+		expected[golden] = struct{}{}
+		compareGolden(t, golden, src)
+	}
+	if *update {
+		return
+	}
+	// golden files of proxies which are no longer generated
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+GoldenSuffix))
+	sub, _ := filepath.Glob(filepath.Join(dir, "*", "*"+GoldenSuffix))
+	for _, name := range append(matches, sub...) {
+		base := filepath.Base(name)
+		if base == DiagnosticsGolden || base == StdoutGolden {
+			continue
+		}
+		if _, ok := expected[name]; !ok {
+			t.Errorf("%s: golden file without generated proxy", name)
+		}
+	}
+}
+
+func compareGolden(t testing.TB, golden string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Errorf("%s: %v, run go test with -update to create it", golden, err)
+		return
+	}
+	if !bytes.Equal(want, got) {
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(want)),
+			B:        difflib.SplitLines(string(got)),
+			FromFile: golden,
+			ToFile:   "generated",
+			Context:  3,
+		})
+		t.Errorf("%s: mismatch, run go test with -update to accept\n%s", golden, diff)
+	}
+}
+
+// writeOverlay stores generated files in a temporary directory and returns a go build -overlay file.
+func writeOverlay(t testing.TB, files map[string][]byte) string {
+	t.Helper()
+	tmp := t.TempDir()
+	replace := map[string]string{}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		path := filepath.Join(tmp, fmt.Sprintf("%d_%s", i, filepath.Base(name)))
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		replace[name] = path
+	}
+	data, err := json.Marshal(map[string]any{"Replace": replace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := filepath.Join(tmp, "overlay.json")
+	if err := os.WriteFile(overlay, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return overlay
+}
+
+func goCmd(t testing.TB, dir string, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("go %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.Bytes()
+}
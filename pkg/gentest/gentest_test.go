@@ -0,0 +1,43 @@
+package gentest
+
+import (
+	"testing"
+
+	"github.com/go-park/sandwich/pkg/gen"
+)
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata/log_aspect", Exec())
+}
+
+func TestRun_singleton(t *testing.T) {
+	Run(t, "testdata/singleton", WithOptions(gen.WithSingleton(true)), Exec())
+}
+
+func TestRun_directive(t *testing.T) {
+	Run(t, "testdata/directive", Exec())
+}
+
+func TestRun_template(t *testing.T) {
+	Run(t, "testdata/template", Exec())
+}
+
+func TestRun_generic(t *testing.T) {
+	Run(t, "testdata/generic", Exec())
+}
+
+func TestRun_signature(t *testing.T) {
+	Run(t, "testdata/signature", Exec())
+}
+
+func TestRun_hygiene(t *testing.T) {
+	Run(t, "testdata/hygiene", Exec())
+}
+
+func TestRun_weave(t *testing.T) {
+	Run(t, "testdata/weave", Exec())
+}
+
+func TestRun_call(t *testing.T) {
+	Run(t, "testdata/call", Exec())
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("upper", mode="call")
+type AspectUpper struct{}
+
+//@Around
+func (a *AspectUpper) Around(pjp aspect.ProceedingJoinpoint) []any {
+	name, _ := pjp.ParamTo(1).(string)
+	return pjp.Proceed(strings.ToUpper(name), pjp.ParamTo(2))
+}
+
+//@After
+func (a *AspectUpper) After(jp aspect.Joinpoint) {
+	inv := jp.(*aspect.Invocation)
+	fmt.Println("upper after", inv.Receiver() != nil, inv.Annotations(), jp.Results())
+}
@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := NewSvcProxy()
+	fmt.Println(s.Greet("bob", 2))
+	fmt.Println(s.Greet("amy", 0))
+	fmt.Println(s.Join("-", "a", "b"))
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+// Timing counts calls, it is compiled and injected like any other component.
+//
+//@Aspect("timing", mode="call")
+type Timing struct {
+	calls map[string]int
+}
+
+//@Component
+func NewTiming() *Timing {
+	return &Timing{calls: map[string]int{}}
+}
+
+//@Around
+func (t *Timing) Around(pjp aspect.ProceedingJoinpoint) []any {
+	t.calls[pjp.FuncName()]++
+	results := pjp.Proceed()
+	fmt.Println(label(pjp.FuncName()), t.calls[pjp.FuncName()], results)
+	return results
+}
+
+func label(name string) string {
+	return "timing " + strings.ToLower(name)
+}
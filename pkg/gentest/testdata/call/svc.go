@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+//@Proxy("ISvc")
+type Svc struct{}
+
+type ISvc interface {
+	Greet(name string, times int) (string, error)
+	Join(sep string, parts ...string) string
+}
+
+//@Pointcut("timing", "upper", "log")
+func (s *Svc) Greet(name string, times int) (string, error) {
+	if times < 1 {
+		return "", fmt.Errorf("greet %s %d times", name, times)
+	}
+	return strings.Repeat("hi "+name+" ", times), nil
+}
+
+//@Pointcut("timing")
+func (s *Svc) Join(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
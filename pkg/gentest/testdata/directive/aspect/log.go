@@ -0,0 +1,26 @@
+//go:build sandwich
+// +build sandwich
+
+package aspect
+
+import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//sandwich:aspect log
+type AspectLog struct{}
+
+//sandwich:before
+func (a *AspectLog) Before(jp aspect.Joinpoint) {
+	fmt.Println("before", jp.FuncName(), jp.Params())
+}
+
+//sandwich:aspect trace custom=Traced
+type AspectTrace struct{}
+
+//sandwich:after
+func (a *AspectTrace) After(jp aspect.Joinpoint) {
+	fmt.Println("after", jp.FuncName(), jp.Results())
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+// Greeter says hello, mail admin@example.com for help.
+//
+//sandwich:proxy IGreeter suffix=Impl
+type Greeter struct{}
+
+type IGreeter interface {
+	Hello(name string) (string, error)
+	Bye(name string) string
+}
+
+//sandwich:pointcut log
+func (g *Greeter) Hello(name string) (string, error) {
+	return fmt.Sprintf("hello %s", name), nil
+}
+
+// Bye is traced by the custom annotation of the trace aspect.
+//
+//sandwich:traced
+func (g *Greeter) Bye(name string) string {
+	return "bye " + name
+}
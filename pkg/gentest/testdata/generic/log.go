@@ -0,0 +1,18 @@
+//go:build sandwich
+// +build sandwich
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("log")
+type AspectLog struct{}
+
+//@Before
+func (a *AspectLog) Before(jp aspect.Joinpoint) {
+	fmt.Println("before", jp.FuncName())
+}
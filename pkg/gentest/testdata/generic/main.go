@@ -0,0 +1,7 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(NewUserServiceProxy().Register("sandwich"))
+}
@@ -0,0 +1,40 @@
+package main
+
+import "github.com/go-park/sandwich/pkg/gentest/testdata/generic/store"
+
+type User struct {
+	Name string
+}
+
+//@Proxy("IRepo")
+type Repo[T any] struct {
+	//@Inject
+	store *store.Store[T]
+}
+
+type IRepo[T any] interface {
+	Save(v T) error
+	Count() int
+}
+
+//@Pointcut("log")
+func (r *Repo[E]) Save(v E) error {
+	r.store.Add(v)
+	return nil
+}
+
+func (r *Repo[T]) Count() int {
+	return r.store.Len()
+}
+
+//@Proxy
+type UserService struct {
+	//@Inject
+	users IRepo[User]
+}
+
+//@Pointcut("log")
+func (s *UserService) Register(name string) int {
+	_ = s.users.Save(User{Name: name})
+	return s.users.Count()
+}
@@ -0,0 +1,18 @@
+package store
+
+type Store[T any] struct {
+	items []T
+}
+
+//@Component
+func NewStore[T any]() *Store[T] {
+	return &Store[T]{}
+}
+
+func (s *Store[T]) Add(v T) {
+	s.items = append(s.items, v)
+}
+
+func (s *Store[T]) Len() int {
+	return len(s.items)
+}
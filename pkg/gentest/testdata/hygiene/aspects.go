@@ -0,0 +1,47 @@
+//go:build sandwich
+// +build sandwich
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("count")
+type AspectCount struct{}
+
+//@Before
+func (a *AspectCount) Before(jp aspect.Joinpoint) {
+	n := len(jp.Params())
+	err := errors.New("count")
+	fmt.Println("count", n, err, pair{n: n})
+}
+
+//@Aspect("retry")
+type AspectRetry struct{}
+
+//@Around
+func (a *AspectRetry) Around(pjp aspect.ProceedingJoinpoint) []any {
+	n := pjp.ParamTo(1).(int)
+	err := fmt.Errorf("retry %d", n)
+	result := pjp.Proceed()
+	fmt.Println("retry", n, err, result)
+	return result
+}
+
+//@Aspect("trace")
+type AspectTrace struct{}
+
+//@Around
+func (a *AspectTrace) Around(pjp aspect.ProceedingJoinpoint) []any {
+	for n := 0; n < 1; n++ {
+		fmt.Println("trace", n)
+	}
+	err := func(p string) error { return errors.New(p) }("trace")
+	result := pjp.Proceed()
+	fmt.Println("trace", err)
+	return result
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+//@Proxy("ISvc")
+type Svc struct{}
+
+// pair has a field named like the locals of advice
+type pair struct {
+	n int
+}
+
+type ISvc interface {
+	Do(n int) (err error)
+}
+
+//@Pointcut("count", "retry", "trace")
+func (s *Svc) Do(n int) (err error) {
+	fmt.Println("do", n)
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build sandwich
+// +build sandwich
+
+package aspect
+
+import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("log")
+type AspectLog struct{}
+
+//@Before
+func (a *AspectLog) Before(jp aspect.Joinpoint) {
+	fmt.Println("before", jp.FuncName(), jp.Params())
+}
+
+//@Around
+func (a *AspectLog) Around(pjp aspect.ProceedingJoinpoint) []any {
+	fmt.Println("around before")
+	result := pjp.Proceed()
+	fmt.Println("around after", pjp.Results())
+	return result
+}
@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+//@Proxy("IGreeter")
+type Greeter struct{}
+
+type IGreeter interface {
+	Hello(name string) (string, error)
+	Bye(name string) string
+}
+
+//@Pointcut("log")
+func (g *Greeter) Hello(name string) (string, error) {
+	return fmt.Sprintf("hello %s", name), nil
+}
+
+func (g *Greeter) Bye(name string) string {
+	return "bye " + name
+}
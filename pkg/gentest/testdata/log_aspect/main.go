@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	g := NewGreeterProxy()
+	fmt.Println(g.Hello("sandwich"))
+	fmt.Println(g.Bye("sandwich"))
+}
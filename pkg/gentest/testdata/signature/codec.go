@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	str "strings"
+)
+
+//@Proxy("ICodec")
+type Codec struct{}
+
+type ICodec interface {
+	Map(fn func(string) (int, error), in map[string][]int) [2]map[string]int
+	Stream(ctx context.Context, in <-chan *str.Builder, out chan<- struct {
+		N int `json:"n"`
+	}) error
+	Join(sep string, parts []string) (s string, _ error)
+	Concat(prefix string, parts ...string) string
+	Any(v interface{ String() string }, _ int) any
+}
+
+//@Pointcut("log")
+func (c *Codec) Map(fn func(string) (int, error), in map[string][]int) [2]map[string]int {
+	var out [2]map[string]int
+	out[0] = map[string]int{}
+	for k, v := range in {
+		n, _ := fn(k)
+		out[0][k] = n + len(v)
+	}
+	return out
+}
+
+//@Pointcut("log")
+func (c *Codec) Stream(ctx context.Context, in <-chan *str.Builder, out chan<- struct {
+	N int `json:"n"`
+}) error {
+	for b := range in {
+		out <- struct {
+			N int `json:"n"`
+		}{N: b.Len()}
+	}
+	close(out)
+	return ctx.Err()
+}
+
+//@Pointcut("log")
+func (c *Codec) Join(sep string, parts []string) (s string, _ error) {
+	return str.Join(parts, sep), nil
+}
+
+//@Pointcut("log")
+func (c *Codec) Any(v interface{ String() string }, _ int) any {
+	return v.String()
+}
+
+//@Pointcut("count")
+func (c *Codec) Concat(prefix string, parts ...string) string {
+	return prefix + str.Join(parts, "")
+}
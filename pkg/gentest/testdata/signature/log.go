@@ -0,0 +1,26 @@
+//go:build sandwich
+// +build sandwich
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("log")
+type AspectLog struct{}
+
+//@Before
+func (a *AspectLog) Before(jp aspect.Joinpoint) {
+	fmt.Println("before", jp.FuncName())
+}
+
+//@Aspect("count")
+type AspectCount struct{}
+
+//@Before
+func (a *AspectCount) Before(jp aspect.Joinpoint) {
+	fmt.Println("count", len(jp.ParamTo(2).([]string)), len(jp.Params()))
+}
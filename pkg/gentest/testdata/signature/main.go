@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func main() {
+	c := NewCodecProxy()
+	fmt.Println(c.Map(func(s string) (int, error) { return len(s), nil }, map[string][]int{"ab": {1}}))
+	in := make(chan *strings.Builder, 1)
+	b := &strings.Builder{}
+	b.WriteString("abc")
+	in <- b
+	close(in)
+	out := make(chan struct {
+		N int `json:"n"`
+	}, 1)
+	fmt.Println(c.Stream(context.Background(), in, out), (<-out).N)
+	fmt.Println(c.Join(",", []string{"a", "b"}))
+	fmt.Println(c.Any(b, 1))
+	fmt.Println(c.Concat("-", "a", "b", "c"))
+}
@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(NewCounterProxy().Inc(), NewCounterProxy().Inc())
+	fmt.Println(NewEnglishProxy().Hello("sandwich"))
+	fmt.Println(NewFrenchProxy().Hello("sandwich"))
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+type Greeter interface {
+	Hello(name string) string
+}
+
+// Counter has no abstract type, its factory returns *CounterProxy
+//
+//@Proxy
+type Counter struct {
+	n int
+}
+
+func (c *Counter) Inc() int {
+	c.n++
+	return c.n
+}
+
+// English and French return the same abstract type
+//
+//@Proxy("Greeter")
+type English struct{}
+
+func (e *English) Hello(name string) string {
+	return fmt.Sprintf("hello %s", name)
+}
+
+//@Proxy("Greeter")
+type French struct{}
+
+func (f *French) Hello(name string) string {
+	return fmt.Sprintf("bonjour %s", name)
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+//@Proxy("IGreeter", template="proxy.tmpl")
+type Greeter struct{}
+
+type IGreeter interface {
+	Hello(name string) string
+}
+
+//@Pointcut("log")
+func (g *Greeter) Hello(name string) string {
+	return fmt.Sprintf("hello %s", name)
+}
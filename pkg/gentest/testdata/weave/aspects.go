@@ -0,0 +1,50 @@
+//go:build sandwich
+// +build sandwich
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-park/sandwich/pkg/aspect"
+)
+
+//@Aspect("guard")
+type AspectGuard struct{}
+
+//@Before
+func (a *AspectGuard) Before(jp aspect.Joinpoint) {
+	// returns leave the advice, not the method
+	for _, v := range jp.ParamTo(2).([]int) {
+		if v < 0 {
+			fmt.Println("negative in", jp.FuncName())
+			return
+		}
+	}
+	fmt.Println("guard jp.Params()", strings.Repeat("=", 2))
+}
+
+//@Aspect("audit")
+type AspectAudit struct{}
+
+//@Around
+func (a *AspectAudit) Around(pjp aspect.ProceedingJoinpoint) []any {
+	name := pjp.ParamTo(1).(string)
+	if len(name) == 0 {
+		return []any{0, fmt.Errorf("no name")}
+	}
+	if name == "early" {
+		return pjp.Results()
+	}
+	func() {
+		defer fmt.Println("audit done")
+		pjp.Proceed()
+	}()
+	fmt.Println(
+		"audit",
+		name,
+		pjp.ResultTo(1).(int),
+	)
+	return pjp.Results()
+}
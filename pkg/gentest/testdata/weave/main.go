@@ -0,0 +1,10 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := NewSvcProxy()
+	fmt.Println(s.Sum("a", []int{1, 2}))
+	fmt.Println(s.Sum("b", []int{-1}))
+	fmt.Println(s.Sum("early", []int{3}))
+}
@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+//@Proxy("ISvc")
+type Svc struct{}
+
+type ISvc interface {
+	Sum(name string, nums []int) (int, error)
+}
+
+//@Pointcut("guard", "audit")
+func (s *Svc) Sum(name string, nums []int) (int, error) {
+	total := 0
+	for _, v := range nums {
+		total += v
+	}
+	fmt.Println("sum", name, total)
+	return total, nil
+}
@@ -39,3 +39,13 @@ func ContainsAny[T comparable](list []T, values ...T) bool {
 	}
 	return f(list, values...)
 }
+
+func Distinct[T comparable](list []T) []T {
+	var result []T
+	for _, v := range list {
+		if !Contains(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}